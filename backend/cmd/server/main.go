@@ -6,7 +6,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"syscall"
 	"time"
@@ -15,6 +14,9 @@ import (
 	"backend/internal/api"
 	"backend/internal/database"
 	"backend/internal/services/admin"
+	"backend/internal/services/compression"
+	"backend/internal/services/jobs"
+	"backend/internal/services/media"
 	"backend/internal/storage"
 
 	"github.com/joho/godotenv"
@@ -28,6 +30,12 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Handle `server migrate ...` without starting the API
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	// Initialize configuration
 	config, err := configs.LoadConfig()
 	if err != nil {
@@ -41,9 +49,9 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize database schema
-	if err := database.InitSchema(db); err != nil {
-		log.Fatalf("Failed to initialize database schema: %v", err)
+	// Apply any pending database migrations
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database schema: %v", err)
 	}
 
 	// Initialize admin account
@@ -52,14 +60,30 @@ func main() {
 		log.Fatalf("Failed to initialize admin account: %v", err)
 	}
 
-	// Initialize S3 client
-	s3Client, err := storage.NewS3Client(config.S3)
+	// Initialize media storage
+	blob, err := storage.NewBlob(config)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 client: %v", err)
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Convert media URLs stored by older versions into object keys
+	if err := database.BackfillMediaKeys(db, blob); err != nil {
+		log.Fatalf("Failed to backfill media keys: %v", err)
 	}
 
+	// Find out which external image decoders are installed and limit how many
+	// media tools run at once
+	compression.ProbeDecoders()
+	compression.ConfigureRunner(config.Media.MaxTranscodes, config.Media.TranscodeTimeout)
+
+	// Start background media processing
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	queue := jobs.NewQueue(db)
+	media.NewProcessor(db, blob, config.Media).Register(queue)
+	queue.Start(workerCtx, config.Jobs.Workers)
+
 	// Initialize router
-	router := api.SetupRouter(db, s3Client, config, adminService)
+	router := api.SetupRouter(db, blob, config, adminService)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -93,35 +117,9 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server exiting")
-}
+	// Stop taking new jobs and let running ones be released
+	stopWorkers()
+	queue.Wait()
 
-func checkDependencies() {
-	log.Println("Checking required dependencies...")
-
-	// Check for FFmpeg
-	ffmpegCmd := exec.Command("ffmpeg", "-version")
-	if err := ffmpegCmd.Run(); err != nil {
-		log.Println("Warning: FFmpeg not found. Video and HEIC conversion may not work properly.")
-		log.Println("Please install FFmpeg: https://ffmpeg.org/download.html")
-	} else {
-		log.Println("✓ FFmpeg found")
-	}
-
-	// Check for ImageMagick
-	convertCmd := exec.Command("convert", "-version")
-	if err := convertCmd.Run(); err != nil {
-		log.Println("Warning: ImageMagick not found. HEIC conversion may use fallback methods.")
-		log.Println("For best results, please install ImageMagick: https://imagemagick.org/script/download.php")
-	} else {
-		log.Println("✓ ImageMagick found")
-	}
-
-	// Check for libheif tools
-	heifCmd := exec.Command("heif-convert", "--version")
-	if err := heifCmd.Run(); err != nil {
-		log.Println("Info: libheif-tools not found. Alternative HEIC conversion methods will be used.")
-	} else {
-		log.Println("✓ libheif-tools found")
-	}
+	log.Println("Server exiting")
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"backend/configs"
+	"backend/internal/database"
+)
+
+// runMigrate implements the `migrate` subcommand:
+//
+//	server migrate [up]       apply all pending migrations
+//	server migrate down [n]   revert the last n migrations (default 1)
+//	server migrate status     list migrations and when they were applied
+func runMigrate(args []string) {
+	dbConfig, err := configs.LoadDatabaseConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.Connect(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if err := database.Migrate(db); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations to revert: %s", args[1])
+			}
+		}
+		if err := database.MigrateDown(db, steps); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+
+	case "status":
+		statuses, err := database.GetMigrationStatus(db)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, applied)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q (expected up, down or status)\n", command)
+		os.Exit(2)
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Storage  StorageConfig
 	S3       S3Config
 	JWT      JWTConfig
+	Jobs     JobsConfig
+	Media    MediaConfig
 }
 
 // ServerConfig holds server configuration
@@ -31,6 +35,21 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// Storage drivers selectable with STORAGE_DRIVER
+const (
+	StorageDriverS3    = "s3"
+	StorageDriverLocal = "local"
+)
+
+// StorageConfig selects where uploaded media is kept
+type StorageConfig struct {
+	Driver       string
+	LocalDir     string        // Directory used by the local driver
+	PublicURL    string        // Base URL the API is reachable at, used by the local driver
+	PrivateMedia bool          // Serve media through presigned URLs instead of public ones
+	URLExpiry    time.Duration // How long presigned media URLs stay valid
+}
+
 // S3Config holds AWS S3 configuration
 type S3Config struct {
 	AccessKey    string
@@ -51,6 +70,25 @@ type JWTConfig struct {
 	ExpirationMin int
 }
 
+// JobsConfig holds background job worker configuration
+type JobsConfig struct {
+	Workers int // Number of worker goroutines processing media jobs
+}
+
+// MediaConfig holds media processing configuration
+type MediaConfig struct {
+	HLS               bool          // Also produce adaptive HLS renditions for videos
+	RetainMetadata    bool          // Save safe image metadata (capture time) with posts
+	MaxImageBytes     int64         // Largest image upload accepted
+	MaxImagePixels    int64         // Most pixels an image may have, checked before it is decoded
+	MaxVideoBytes     int64         // Largest video upload accepted
+	MaxVideoDuration  time.Duration // Longest video accepted
+	MaxVideoDimension int           // Largest width or height of a video accepted, in pixels
+	MaxTranscodes     int           // Most ffmpeg and other media tool runs at once, 0 for the default
+	TranscodeTimeout  time.Duration // Longest a single media tool run may take
+	MatchDistance     int           // Most differing perceptual hash bits for media to count as a copy
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	// Load server config
@@ -65,15 +103,36 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Load database config
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbSSLMode := os.Getenv("DB_SSLMODE")
+	database, err := LoadDatabaseConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Load storage config
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	if storageDriver == "" {
+		storageDriver = StorageDriverS3
+	}
 
-	if dbHost == "" || dbPort == "" || dbUser == "" || dbPassword == "" || dbName == "" {
-		return nil, errors.New("database configuration is incomplete")
+	localDir := os.Getenv("LOCAL_STORAGE_DIR")
+	if localDir == "" {
+		localDir = "./uploads"
+	}
+
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	// The local store serves its directory publicly and can't sign URLs
+	privateMedia, _ := strconv.ParseBool(os.Getenv("PRIVATE_MEDIA"))
+	if privateMedia && storageDriver == StorageDriverLocal {
+		return nil, errors.New("PRIVATE_MEDIA requires the s3 storage driver")
+	}
+
+	urlExpiryMin, err := strconv.Atoi(os.Getenv("MEDIA_URL_EXPIRATION_MIN"))
+	if err != nil || urlExpiryMin < 1 {
+		urlExpiryMin = 15
 	}
 
 	// Load S3 config
@@ -84,10 +143,65 @@ func LoadConfig() (*Config, error) {
 	s3Endpoint := os.Getenv("S3_ENDPOINT")
 	s3UsePathStyle, _ := strconv.ParseBool(os.Getenv("S3_USE_PATH_STYLE"))
 
-	if s3AccessKey == "" || s3SecretKey == "" || s3Region == "" || s3Bucket == "" {
+	if storageDriver == StorageDriverS3 && (s3AccessKey == "" || s3SecretKey == "" || s3Region == "" || s3Bucket == "") {
 		return nil, errors.New("S3 configuration is incomplete")
 	}
 
+	// Load job worker config
+	jobWorkers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || jobWorkers < 1 {
+		jobWorkers = 2
+	}
+
+	// Load media config. HLS playlists refer to their segments by relative
+	// URL, which can't carry a presigned signature.
+	hlsEnabled, _ := strconv.ParseBool(os.Getenv("HLS_ENABLED"))
+	if hlsEnabled && privateMedia {
+		return nil, errors.New("HLS_ENABLED requires public media, unset PRIVATE_MEDIA")
+	}
+
+	retainMetadata, _ := strconv.ParseBool(os.Getenv("MEDIA_RETAIN_METADATA"))
+
+	maxImageMB, err := strconv.Atoi(os.Getenv("MEDIA_MAX_IMAGE_MB"))
+	if err != nil || maxImageMB < 1 {
+		maxImageMB = 25
+	}
+
+	maxImageMegapixels, err := strconv.Atoi(os.Getenv("MEDIA_MAX_IMAGE_MEGAPIXELS"))
+	if err != nil || maxImageMegapixels < 1 {
+		maxImageMegapixels = 100
+	}
+
+	maxVideoMB, err := strconv.Atoi(os.Getenv("MEDIA_MAX_VIDEO_MB"))
+	if err != nil || maxVideoMB < 1 {
+		maxVideoMB = 500
+	}
+
+	maxVideoDurationSec, err := strconv.Atoi(os.Getenv("MEDIA_MAX_VIDEO_DURATION_SEC"))
+	if err != nil || maxVideoDurationSec < 1 {
+		maxVideoDurationSec = 10 * 60 // 10 minutes
+	}
+
+	maxVideoDimension, err := strconv.Atoi(os.Getenv("MEDIA_MAX_VIDEO_DIMENSION"))
+	if err != nil || maxVideoDimension < 1 {
+		maxVideoDimension = 3840 // 4K
+	}
+
+	maxTranscodes, err := strconv.Atoi(os.Getenv("MEDIA_MAX_TRANSCODES"))
+	if err != nil || maxTranscodes < 0 {
+		maxTranscodes = 0 // Half the CPUs
+	}
+
+	transcodeTimeoutMin, err := strconv.Atoi(os.Getenv("MEDIA_TRANSCODE_TIMEOUT_MIN"))
+	if err != nil || transcodeTimeoutMin < 1 {
+		transcodeTimeoutMin = 15
+	}
+
+	matchDistance, err := strconv.Atoi(os.Getenv("MEDIA_MATCH_DISTANCE"))
+	if err != nil || matchDistance < 0 {
+		matchDistance = 8 // Of 64 bits
+	}
+
 	// Load JWT config
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -104,13 +218,13 @@ func LoadConfig() (*Config, error) {
 			Port:         port,
 			AllowOrigins: allowOrigins,
 		},
-		Database: DatabaseConfig{
-			Host:     dbHost,
-			Port:     dbPort,
-			User:     dbUser,
-			Password: dbPassword,
-			DBName:   dbName,
-			SSLMode:  dbSSLMode,
+		Database: database,
+		Storage: StorageConfig{
+			Driver:       storageDriver,
+			LocalDir:     localDir,
+			PublicURL:    publicURL,
+			PrivateMedia: privateMedia,
+			URLExpiry:    time.Duration(urlExpiryMin) * time.Minute,
 		},
 		S3: S3Config{
 			AccessKey:    s3AccessKey,
@@ -124,5 +238,39 @@ func LoadConfig() (*Config, error) {
 			Secret:        jwtSecret,
 			ExpirationMin: jwtExpirationMin,
 		},
+		Jobs: JobsConfig{
+			Workers: jobWorkers,
+		},
+		Media: MediaConfig{
+			HLS:               hlsEnabled,
+			RetainMetadata:    retainMetadata,
+			MaxImageBytes:     int64(maxImageMB) << 20,
+			MaxImagePixels:    int64(maxImageMegapixels) * 1000000,
+			MaxVideoBytes:     int64(maxVideoMB) << 20,
+			MaxVideoDuration:  time.Duration(maxVideoDurationSec) * time.Second,
+			MaxVideoDimension: maxVideoDimension,
+			MaxTranscodes:     maxTranscodes,
+			TranscodeTimeout:  time.Duration(transcodeTimeoutMin) * time.Minute,
+			MatchDistance:     matchDistance,
+		},
 	}, nil
 }
+
+// LoadDatabaseConfig loads only the database configuration, for commands
+// such as migrate that don't need the rest of the server's settings
+func LoadDatabaseConfig() (DatabaseConfig, error) {
+	config := DatabaseConfig{
+		Host:     os.Getenv("DB_HOST"),
+		Port:     os.Getenv("DB_PORT"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
+
+	if config.Host == "" || config.Port == "" || config.User == "" || config.Password == "" || config.DBName == "" {
+		return DatabaseConfig{}, errors.New("database configuration is incomplete")
+	}
+
+	return config, nil
+}
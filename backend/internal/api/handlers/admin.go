@@ -3,13 +3,19 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"backend/internal/models"
 	"backend/internal/services/admin"
+	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -17,13 +23,15 @@ import (
 type AdminHandler struct {
 	db           *sqlx.DB
 	adminService *admin.AdminService
+	blob         storage.Blob
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(db *sqlx.DB, adminService *admin.AdminService) *AdminHandler {
+func NewAdminHandler(db *sqlx.DB, adminService *admin.AdminService, blob storage.Blob) *AdminHandler {
 	return &AdminHandler{
 		db:           db,
 		adminService: adminService,
+		blob:         blob,
 	}
 }
 
@@ -152,24 +160,31 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// Delete user's comments
-	_, err = tx.Exec("DELETE FROM comments WHERE user_id = $1", targetUserID)
-	if err != nil {
+	// Delete user's comments, keeping those with replies as tombstones
+	if err := deleteUserComments(tx, targetUserID); err != nil {
+		log.Printf("DeleteUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comments"})
 		return
 	}
 
-	// Get user's posts
-	var postIDs []string
-	err = tx.Select(&postIDs, "SELECT id FROM posts WHERE user_id = $1", targetUserID)
+	// Note the avatar, to delete after the user
+	var avatarKey sql.NullString
+	if err := tx.Get(&avatarKey, "SELECT profile_picture_key FROM users WHERE id = $1", targetUserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	// Get user's posts, noting their files to delete afterwards
+	posts, err := getUserPostMedia(tx, targetUserID)
 	if err != nil {
+		log.Printf("DeleteUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
 	// Delete comments on user's posts
-	for _, postID := range postIDs {
-		_, err = tx.Exec("DELETE FROM comments WHERE post_id = $1", postID)
+	for _, post := range posts {
+		_, err = tx.Exec("DELETE FROM comments WHERE post_id = $1", post.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post comments"})
 			return
@@ -203,6 +218,14 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Delete media from S3 after the database transaction is complete
+	for _, post := range posts {
+		deletePostMedia(c.Request.Context(), h.blob, post)
+	}
+	if avatarKey.Valid {
+		deleteAvatar(c.Request.Context(), h.blob, avatarKey.String)
+	}
+
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
@@ -285,14 +308,19 @@ func (h *AdminHandler) DeletePost(c *gin.Context) {
 	postID := c.Param("id")
 
 	// Check if post exists
-	var postExists bool
-	err = h.db.Get(&postExists, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1)", postID)
+	var post models.Post
+	err = h.db.Get(&post, "SELECT id, media_key, thumbnail_key, playlist_key FROM posts WHERE id = $1", postID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if !postExists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+	if err := loadPostMedia(h.db, &post); err != nil {
+		log.Printf("DeletePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
@@ -304,6 +332,13 @@ func (h *AdminHandler) DeletePost(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	// Keep the media from being posted again; its hashes go with the post
+	if err := blockPostHashes(tx, postID, adminID.(string), "Deleted by a moderator"); err != nil {
+		log.Printf("DeletePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block post media"})
+		return
+	}
+
 	// Delete comments
 	_, err = tx.Exec("DELETE FROM comments WHERE post_id = $1", postID)
 	if err != nil {
@@ -324,10 +359,68 @@ func (h *AdminHandler) DeletePost(c *gin.Context) {
 		return
 	}
 
+	// Delete media from S3 after the database transaction is complete
+	deletePostMedia(c.Request.Context(), h.blob, post)
+
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully by admin"})
 }
 
+// RemovePost takes a post down without deleting it. The owner can still see
+// it along with the reason given. Its media is blocked from being posted
+// again.
+func (h *AdminHandler) RemovePost(c *gin.Context) {
+	adminID := c.GetString("userID")
+	postID := c.Param("id")
+
+	// Parse request
+	var req struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Removed by a moderator"
+	}
+
+	tx, err := h.db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE posts SET status = $1, status_reason = $2, updated_at = $3 WHERE id = $4",
+		models.PostStatusRemoved, req.Reason, time.Now(), postID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove post"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if err := blockPostHashes(tx, postID, adminID, req.Reason); err != nil {
+		log.Printf("RemovePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block post media"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Post removed successfully by admin"})
+}
+
 // DeleteComment allows an admin to delete any comment
 func (h *AdminHandler) DeleteComment(c *gin.Context) {
 	// Get admin ID from context
@@ -354,7 +447,7 @@ func (h *AdminHandler) DeleteComment(c *gin.Context) {
 
 	// Check if comment exists
 	var commentExists bool
-	err = h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1)", commentID)
+	err = h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND deleted_at IS NULL)", commentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -364,13 +457,25 @@ func (h *AdminHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	// Delete comment
-	_, err = h.db.Exec("DELETE FROM comments WHERE id = $1", commentID)
+	// Delete comment, keeping a tombstone if it has replies
+	tx, err := h.db.Beginx()
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := deleteComment(tx, commentID); err != nil {
+		log.Printf("DeleteComment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully by admin"})
 }
@@ -390,26 +495,193 @@ func (h *AdminHandler) DeleteInviteCode(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Invite code deleted successfully"})
 }
 
+// GetAllComments returns a page of comments across all posts, newest first
 func (h *AdminHandler) GetAllComments(c *gin.Context) {
-	// Get comments with post information
-	var comments []struct {
+	limit, cursor, err := parsePageParams(c, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get comments with post information, fetching one extra to know whether another page exists
+	comments := []struct {
 		models.Comment
 		PostTitle string `json:"postTitle" db:"post_title"`
-	}
+	}{}
+
+	condition, args := cursorCondition(cursor, "c.created_at", "c.id", nil)
+	args = append(args, limit+1)
 
-	err := h.db.Select(&comments, `
+	err = h.db.Select(&comments, fmt.Sprintf(`
         SELECT c.*, u.username, p.caption as post_title 
         FROM comments c 
         JOIN users u ON c.user_id = u.id 
         JOIN posts p ON c.post_id = p.id
-        ORDER BY c.created_at DESC 
-        LIMIT 100
-    `)
+        WHERE c.deleted_at IS NULL AND %s
+        ORDER BY c.created_at DESC, c.id DESC 
+        LIMIT $%d
+    `, condition, len(args)), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
 		return
 	}
 
+	nextCursor := ""
+	if len(comments) > limit {
+		comments = comments[:limit]
+		last := comments[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
 	// Return comments
-	c.JSON(http.StatusOK, comments)
+	c.JSON(http.StatusOK, models.Page{Items: comments, NextCursor: nextCursor})
+}
+
+// GetBlockedHashes returns a page of the media hash blocklist, newest first
+func (h *AdminHandler) GetBlockedHashes(c *gin.Context) {
+	limit, cursor, err := parsePageParams(c, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get blocked hashes, fetching one extra to know whether another page exists
+	condition, args := cursorCondition(cursor, "created_at", "id", nil)
+	args = append(args, limit+1)
+
+	blocked := []models.BlockedHash{}
+	err = h.db.Select(&blocked, fmt.Sprintf(`
+		SELECT * FROM blocked_hashes
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, condition, len(args)), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get blocked hashes"})
+		return
+	}
+
+	nextCursor := ""
+	if len(blocked) > limit {
+		blocked = blocked[:limit]
+		last := blocked[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	for i := range blocked {
+		blocked[i].HashHex = formatHash(blocked[i].Hash)
+	}
+
+	// Return blocked hashes
+	c.JSON(http.StatusOK, models.Page{Items: blocked, NextCursor: nextCursor})
+}
+
+// BlockHashes adds media to the blocklist, either every hash of a post or a
+// single hash given in hex
+func (h *AdminHandler) BlockHashes(c *gin.Context) {
+	adminID := c.GetString("userID")
+
+	// Parse request
+	var req struct {
+		PostID string `json:"postId"`
+		Hash   string `json:"hash"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if (req.PostID == "") == (req.Hash == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send either a post ID or a hash"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Blocked by a moderator"
+	}
+
+	if req.Hash != "" {
+		hash, err := strconv.ParseUint(req.Hash, 16, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Hash must be 16 hex digits"})
+			return
+		}
+		if err := blockHash(h.db, int64(hash), nil, adminID, req.Reason); err != nil {
+			log.Printf("BlockHashes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block hash"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Hash blocked successfully"})
+		return
+	}
+
+	var count int
+	err := h.db.Get(&count, "SELECT COUNT(*) FROM media_hashes WHERE post_id = $1", req.PostID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No media hashes found for this post"})
+		return
+	}
+
+	if err := blockPostHashes(h.db, req.PostID, adminID, req.Reason); err != nil {
+		log.Printf("BlockHashes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block post media"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusCreated, gin.H{"message": "Post media blocked successfully"})
+}
+
+// UnblockHash removes a hash from the blocklist
+func (h *AdminHandler) UnblockHash(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM blocked_hashes WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock hash"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blocked hash not found"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{"message": "Hash unblocked successfully"})
+}
+
+// blockPostHashes adds every media hash of a post to the blocklist. Hashes
+// already blocked keep their original entry.
+func blockPostHashes(db sqlx.Ext, postID, adminID, reason string) error {
+	var hashes []int64
+	if err := sqlx.Select(db, &hashes, "SELECT DISTINCT hash FROM media_hashes WHERE post_id = $1", postID); err != nil {
+		return fmt.Errorf("failed to get media hashes: %w", err)
+	}
+	for _, hash := range hashes {
+		if err := blockHash(db, hash, &postID, adminID, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockHash adds a hash to the blocklist unless it is already there
+func blockHash(db sqlx.Execer, hash int64, postID *string, adminID, reason string) error {
+	_, err := db.Exec(
+		`INSERT INTO blocked_hashes (id, hash, reason, post_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hash) DO NOTHING`,
+		uuid.New().String(), hash, reason, postID, adminID, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to block hash: %w", err)
+	}
+	return nil
+}
+
+// formatHash renders a stored hash as 16 hex digits
+func formatHash(hash int64) string {
+	return fmt.Sprintf("%016x", uint64(hash))
 }
@@ -9,6 +9,7 @@ import (
 	"backend/internal/models"
 	"backend/internal/services/admin"
 	"backend/internal/services/auth"
+	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,13 +20,15 @@ import (
 type AuthHandler struct {
 	db         *sqlx.DB
 	jwtService *auth.JWTService
+	urls       *storage.URLSigner
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *sqlx.DB, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(db *sqlx.DB, jwtService *auth.JWTService, urls *storage.URLSigner) *AuthHandler {
 	return &AuthHandler{
 		db:         db,
 		jwtService: jwtService,
+		urls:       urls,
 	}
 }
 
@@ -98,8 +101,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	profilePicture := ""
-	if user.ProfilePicture.Valid {
-		profilePicture = user.ProfilePicture.String
+	if user.ProfilePictureKey.Valid {
+		profilePicture = h.urls.Batch(c.Request.Context()).URL(user.ProfilePictureKey.String)
 	}
 
 	userResponse := models.UserResponse{
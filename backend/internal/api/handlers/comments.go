@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// replyCountColumn selects the number of direct replies to comment c
+const replyCountColumn = "(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.id) AS reply_count"
+
+// commentOrders are the ways comments on a post can be sorted, by the value
+// of the sort query parameter. Oldest first is the default.
+var commentOrders = map[string]string{
+	"oldest": "c.created_at ASC, c.id ASC",
+	"newest": "c.created_at DESC, c.id DESC",
+	"top":    "c.likes DESC, c.created_at ASC, c.id ASC",
+}
+
+// loadComments fills in a post's top-level comments in the given order (one
+// of commentOrders) and its comment count. Replies are fetched separately
+// with GetReplies.
+func loadComments(db *sqlx.DB, post *models.Post, viewerID, order string) error {
+	post.Comments = []models.Comment{}
+	err := db.Select(
+		&post.Comments,
+		fmt.Sprintf(`SELECT c.*, COALESCE(u.username, '') AS username, %s
+		FROM comments c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE c.post_id = $1 AND c.parent_comment_id IS NULL
+		ORDER BY %s`, replyCountColumn, order),
+		post.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get comments: %w", err)
+	}
+	if err := markLikedComments(db, post.Comments, viewerID); err != nil {
+		return err
+	}
+	renderComments(post.Comments)
+
+	// Count replies too, but not tombstones
+	err = db.Get(&post.CommentCount, "SELECT COUNT(*) FROM comments WHERE post_id = $1 AND deleted_at IS NULL", post.ID)
+	if err != nil {
+		return fmt.Errorf("failed to count comments: %w", err)
+	}
+	return nil
+}
+
+// markLikedComments sets Liked on the comments the viewer has liked
+func markLikedComments(db sqlx.Queryer, comments []models.Comment, viewerID string) error {
+	if viewerID == "" || len(comments) == 0 {
+		return nil
+	}
+
+	commentIDs := make([]string, len(comments))
+	for i := range comments {
+		commentIDs[i] = comments[i].ID
+	}
+
+	var likedIDs []string
+	err := sqlx.Select(
+		db,
+		&likedIDs,
+		"SELECT comment_id FROM comment_likes WHERE user_id = $1 AND comment_id = ANY($2)",
+		viewerID, pq.Array(commentIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get comment like status: %w", err)
+	}
+
+	liked := make(map[string]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	for i := range comments {
+		comments[i].Liked = liked[comments[i].ID]
+	}
+	return nil
+}
+
+// renderComments hides the author of deleted comments kept for their replies
+func renderComments(comments []models.Comment) {
+	for i := range comments {
+		if comments[i].DeletedAt != nil {
+			comments[i].Deleted = true
+			comments[i].UserID = nil
+			comments[i].Username = ""
+			comments[i].Content = ""
+			comments[i].Entities = nil
+		}
+	}
+}
+
+// deleteComment removes a comment. A comment with replies is blanked and kept
+// as a tombstone so its thread survives; tombstones left without any replies
+// are removed along with it.
+func deleteComment(tx *sqlx.Tx, commentID string) error {
+	// Mentions go with the text
+	_, err := tx.Exec("DELETE FROM notifications WHERE comment_id = $1 AND type = $2", commentID, models.NotificationMention)
+	if err != nil {
+		return fmt.Errorf("failed to delete mention notifications: %w", err)
+	}
+
+	var replies int
+	if err := tx.Get(&replies, "SELECT COUNT(*) FROM comments WHERE parent_comment_id = $1", commentID); err != nil {
+		return fmt.Errorf("failed to count replies: %w", err)
+	}
+	if replies > 0 {
+		now := time.Now()
+		_, err := tx.Exec("UPDATE comments SET content = '', content_entities = '[]', deleted_at = $1, updated_at = $1 WHERE id = $2", now, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to mark comment deleted: %w", err)
+		}
+		_, err = saveEntities(tx, "comment", commentID, nil)
+		return err
+	}
+
+	id := commentID
+	for {
+		var parentID *string
+		if err := tx.Get(&parentID, "DELETE FROM comments WHERE id = $1 RETURNING parent_comment_id", id); err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+		if parentID == nil {
+			return nil
+		}
+
+		// Remove the parent too if it was a tombstone kept only for this reply
+		var orphaned bool
+		err := tx.Get(
+			&orphaned,
+			`SELECT deleted_at IS NOT NULL AND NOT EXISTS(SELECT 1 FROM comments WHERE parent_comment_id = $1)
+			FROM comments WHERE id = $1`,
+			*parentID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to check parent comment: %w", err)
+		}
+		if !orphaned {
+			return nil
+		}
+		id = *parentID
+	}
+}
+
+// deleteUserComments removes every comment by a user who is being deleted,
+// with deleteComment, so comments with replies are kept as tombstones. The
+// tombstones outlive the user.
+func deleteUserComments(tx *sqlx.Tx, userID string) error {
+	// Deepest first, so that the user's own replies are gone before their
+	// parents are checked for replies
+	var commentIDs []string
+	err := tx.Select(&commentIDs, "SELECT id FROM comments WHERE user_id = $1 AND deleted_at IS NULL ORDER BY depth DESC", userID)
+	if err != nil {
+		return fmt.Errorf("failed to get comments: %w", err)
+	}
+
+	for _, commentID := range commentIDs {
+		if err := deleteComment(tx, commentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetReplies returns a page of a comment's direct replies, oldest first
+func (h *PostHandler) GetReplies(c *gin.Context) {
+	limit, cursor, err := parsePageParams(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	commentID := c.Param("id")
+
+	// Replies are visible to whoever can see the post
+	var post models.Post
+	err = h.db.Get(
+		&post,
+		`SELECT p.id, p.user_id, p.status
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		WHERE c.id = $1`,
+		commentID,
+	)
+	if err != nil || !canViewPost(post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	// Get replies, fetching one extra to know whether another page exists
+	condition, args := ascendingCursorCondition(cursor, "c.created_at", "c.id", []interface{}{commentID})
+	args = append(args, limit+1)
+
+	replies := []models.Comment{}
+	err = h.db.Select(
+		&replies,
+		fmt.Sprintf(`SELECT c.*, COALESCE(u.username, '') AS username, %s
+		FROM comments c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE c.parent_comment_id = $1 AND %s
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT $%d`, replyCountColumn, condition, len(args)),
+		args...,
+	)
+	if err != nil {
+		log.Printf("GetReplies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get replies"})
+		return
+	}
+
+	nextCursor := ""
+	if len(replies) > limit {
+		replies = replies[:limit]
+		last := replies[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := markLikedComments(h.db, replies, viewerID(c)); err != nil {
+		log.Printf("GetReplies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get replies"})
+		return
+	}
+
+	// Return replies
+	renderComments(replies)
+	c.JSON(http.StatusOK, models.Page{Items: replies, NextCursor: nextCursor})
+}
+
+// LikeComment adds a like to a comment
+func (h *PostHandler) LikeComment(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	commentID := c.Param("id")
+
+	// Check if comment exists on a visible post; tombstones can't be liked
+	var commentExists bool
+	err := h.db.Get(
+		&commentExists,
+		`SELECT EXISTS(
+			SELECT 1 FROM comments c JOIN posts p ON c.post_id = p.id
+			WHERE c.id = $1 AND c.deleted_at IS NULL AND p.status = 'ready'
+		)`,
+		commentID,
+	)
+	if err != nil {
+		log.Printf("LikeComment: Database error checking if comment exists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !commentExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	// Start a transaction
+	tx, err := h.db.Beginx()
+	if err != nil {
+		log.Printf("LikeComment: Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Add the like unless the user already liked the comment
+	result, err := tx.Exec(
+		`INSERT INTO comment_likes (id, comment_id, user_id, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (comment_id, user_id) DO NOTHING`,
+		uuid.New().String(), commentID, userID, time.Now(),
+	)
+	if err != nil {
+		log.Printf("LikeComment: Failed to insert like record: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like comment"})
+		return
+	}
+
+	// Increment comment likes count
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		_, err = tx.Exec("UPDATE comments SET likes = likes + 1 WHERE id = $1", commentID)
+		if err != nil {
+			log.Printf("LikeComment: Failed to update comment like count: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update like count"})
+			return
+		}
+	}
+
+	// Get updated like count
+	var likeCount int
+	if err := tx.Get(&likeCount, "SELECT likes FROM comments WHERE id = $1", commentID); err != nil {
+		log.Printf("LikeComment: Failed to get updated like count: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get like count"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("LikeComment: Failed to commit transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment liked successfully",
+		"likes":   likeCount,
+		"liked":   true,
+	})
+}
+
+// UnlikeComment removes a like from a comment
+func (h *PostHandler) UnlikeComment(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	commentID := c.Param("id")
+
+	// Start a transaction
+	tx, err := h.db.Beginx()
+	if err != nil {
+		log.Printf("UnlikeComment: Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Remove the like if there is one
+	result, err := tx.Exec("DELETE FROM comment_likes WHERE comment_id = $1 AND user_id = $2", commentID, userID)
+	if err != nil {
+		log.Printf("UnlikeComment: Failed to delete like record: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike comment"})
+		return
+	}
+
+	// Decrement comment likes count
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		_, err = tx.Exec("UPDATE comments SET likes = GREATEST(0, likes - 1) WHERE id = $1", commentID)
+		if err != nil {
+			log.Printf("UnlikeComment: Failed to update comment like count: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update like count"})
+			return
+		}
+	}
+
+	// Get updated like count
+	var likeCount int
+	if err := tx.Get(&likeCount, "SELECT likes FROM comments WHERE id = $1", commentID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		log.Printf("UnlikeComment: Failed to get updated like count: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get like count"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("UnlikeComment: Failed to commit transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment unliked successfully",
+		"likes":   likeCount,
+		"liked":   false,
+	})
+}
+
+// GetCommentLikeStatus returns whether a user has liked a comment
+func (h *PostHandler) GetCommentLikeStatus(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	commentID := c.Param("id")
+
+	// Get like count
+	var likeCount int
+	err := h.db.Get(&likeCount, "SELECT likes FROM comments WHERE id = $1", commentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		log.Printf("GetCommentLikeStatus: Failed to get like count: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get like count"})
+		return
+	}
+
+	// Check if user has liked the comment
+	var liked bool
+	err = h.db.Get(&liked, "SELECT EXISTS(SELECT 1 FROM comment_likes WHERE comment_id = $1 AND user_id = $2)", commentID, userID)
+	if err != nil {
+		log.Printf("GetCommentLikeStatus: Failed to check if user liked comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking like status"})
+		return
+	}
+
+	// Return response
+	c.JSON(http.StatusOK, gin.H{
+		"liked": liked,
+		"likes": likeCount,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/services/entities"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// parseEntities finds the mentions and hashtags in text, keeping only
+// mentions of users that exist
+func parseEntities(q sqlx.Queryer, text string) (models.Entities, error) {
+	found := entities.Parse(text)
+
+	var usernames []string
+	for _, entity := range found {
+		if entity.Type == models.EntityMention {
+			usernames = append(usernames, entity.Text)
+		}
+	}
+	if len(usernames) == 0 {
+		return found, nil
+	}
+
+	var users []struct {
+		ID       string `db:"id"`
+		Username string `db:"username"`
+	}
+	err := sqlx.Select(q, &users, "SELECT id, username FROM users WHERE username = ANY($1)", pq.Array(usernames))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+	userIDs := make(map[string]string, len(users))
+	for _, user := range users {
+		userIDs[user.Username] = user.ID
+	}
+
+	resolved := found[:0]
+	for _, entity := range found {
+		if entity.Type == models.EntityMention {
+			entity.UserID = userIDs[entity.Text]
+			if entity.UserID == "" {
+				continue
+			}
+		}
+		resolved = append(resolved, entity)
+	}
+	return resolved, nil
+}
+
+// saveEntities replaces the mentions and hashtags recorded for a post or
+// comment (kind is "post" or "comment") with those in found. It returns the
+// users who weren't mentioned before, to be notified.
+func saveEntities(tx *sqlx.Tx, kind, id string, found models.Entities) ([]string, error) {
+	var previous []string
+	if err := tx.Select(&previous, fmt.Sprintf("SELECT user_id FROM %s_mentions WHERE %s_id = $1", kind, kind), id); err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s_mentions WHERE %s_id = $1", kind, kind), id); err != nil {
+		return nil, fmt.Errorf("failed to clear mentions: %w", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s_hashtags WHERE %s_id = $1", kind, kind), id); err != nil {
+		return nil, fmt.Errorf("failed to clear hashtags: %w", err)
+	}
+
+	seen := make(map[string]bool, len(previous))
+	for _, userID := range previous {
+		seen[userID] = true
+	}
+	var mentioned []string
+	for _, entity := range found {
+		var err error
+		switch entity.Type {
+		case models.EntityMention:
+			_, err = tx.Exec(
+				fmt.Sprintf("INSERT INTO %s_mentions (%s_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", kind, kind),
+				id, entity.UserID,
+			)
+			if !seen[entity.UserID] {
+				seen[entity.UserID] = true
+				mentioned = append(mentioned, entity.UserID)
+			}
+		case models.EntityHashtag:
+			_, err = tx.Exec(
+				fmt.Sprintf("INSERT INTO %s_hashtags (%s_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING", kind, kind),
+				id, entity.Text,
+			)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save %s: %w", entity.Type, err)
+		}
+	}
+	return mentioned, nil
+}
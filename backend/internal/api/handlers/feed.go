@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Number of newest comments included with each post in a feed
+const commentPreviewLimit = 3
+
+// viewerID returns the authenticated user's ID, or "" for anonymous requests
+func viewerID(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return userID.(string)
+	}
+	return ""
+}
+
+// visibleCondition returns a condition limiting posts to those the viewer may
+// see in a listing: ready posts, plus the viewer's own posts that are still
+// processing or have failed. Its arguments are appended to args.
+func visibleCondition(viewerID string, args []interface{}) (string, []interface{}) {
+	if viewerID == "" {
+		return "p.status = 'ready'", args
+	}
+
+	args = append(args, viewerID)
+	condition := fmt.Sprintf("(p.status = 'ready' OR (p.user_id = $%d AND p.status IN ('processing', 'failed')))", len(args))
+	return condition, args
+}
+
+// canViewPost reports whether a single post may be shown to the viewer.
+// Owners can always see their own posts, including removed ones, so they can
+// read why it was taken down.
+func canViewPost(post models.Post, viewerID string) bool {
+	return post.Status == models.PostStatusReady || (viewerID != "" && post.UserID == viewerID)
+}
+
+// assembleFeed fills in media items, like status, comment counts and comment
+// previews for a page of posts. It issues a fixed number of queries regardless
+// of page size.
+func assembleFeed(db *sqlx.DB, posts []models.Post, viewerID string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]string, len(posts))
+	index := make(map[string]*models.Post, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+		index[posts[i].ID] = &posts[i]
+		posts[i].Comments = []models.Comment{}
+	}
+
+	// Load every post's media items
+	pointers := make([]*models.Post, len(posts))
+	for i := range posts {
+		pointers[i] = &posts[i]
+	}
+	if err := loadPostMedia(db, pointers...); err != nil {
+		return err
+	}
+
+	// Check which posts the viewer has liked
+	if viewerID != "" {
+		var likedIDs []string
+		err := db.Select(
+			&likedIDs,
+			"SELECT post_id FROM post_likes WHERE user_id = $1 AND post_id = ANY($2)",
+			viewerID, pq.Array(postIDs),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get like status: %w", err)
+		}
+		for _, id := range likedIDs {
+			index[id].Liked = true
+		}
+	}
+
+	// Get the newest top-level comments for every post along with each post's
+	// total, which includes replies but not tombstones
+	var comments []struct {
+		models.Comment
+		Rank  int `db:"comment_rank"`
+		Total int `db:"comment_total"`
+	}
+	err := db.Select(
+		&comments,
+		fmt.Sprintf(`SELECT * FROM (
+			SELECT c.*, COALESCE(u.username, '') AS username, %s,
+				ROW_NUMBER() OVER (PARTITION BY c.post_id, c.parent_comment_id IS NULL ORDER BY c.created_at DESC, c.id DESC) AS comment_rank,
+				COUNT(*) FILTER (WHERE c.deleted_at IS NULL) OVER (PARTITION BY c.post_id) AS comment_total
+			FROM comments c
+			LEFT JOIN users u ON c.user_id = u.id
+			WHERE c.post_id = ANY($1)
+		) ranked
+		WHERE parent_comment_id IS NULL AND comment_rank <= $2
+		ORDER BY created_at ASC`, replyCountColumn),
+		pq.Array(postIDs), commentPreviewLimit,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get comments: %w", err)
+	}
+
+	// Check which of the previews the viewer has liked, for the whole page at
+	// once
+	previews := make([]models.Comment, len(comments))
+	for i := range comments {
+		previews[i] = comments[i].Comment
+	}
+	if err := markLikedComments(db, previews, viewerID); err != nil {
+		return err
+	}
+
+	for i, comment := range comments {
+		post := index[comment.PostID]
+		post.CommentCount = comment.Total
+		post.Comments = append(post.Comments, previews[i])
+	}
+	for i := range posts {
+		renderComments(posts[i].Comments)
+	}
+
+	return nil
+}
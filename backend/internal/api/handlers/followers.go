@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"backend/internal/models"
+	"backend/internal/services/notifications"
+	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -13,13 +17,15 @@ import (
 
 // FollowerHandler handles follower-related requests
 type FollowerHandler struct {
-	db *sqlx.DB
+	db   *sqlx.DB
+	urls *storage.URLSigner
 }
 
 // NewFollowerHandler creates a new follower handler
-func NewFollowerHandler(db *sqlx.DB) *FollowerHandler {
+func NewFollowerHandler(db *sqlx.DB, urls *storage.URLSigner) *FollowerHandler {
 	return &FollowerHandler{
-		db: db,
+		db:   db,
+		urls: urls,
 	}
 }
 
@@ -71,11 +77,29 @@ func (h *FollowerHandler) FollowUser(c *gin.Context) {
 	followID := uuid.New().String()
 	now := time.Now()
 
-	_, err = h.db.Exec(
+	tx, err := h.db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
 		"INSERT INTO followers (id, follower_id, followed_id, created_at) VALUES ($1, $2, $3, $4)",
 		followID, followerID, followedID, now,
 	)
+	if err == nil {
+		err = notifications.Notify(tx, notifications.Event{
+			Type:    models.NotificationFollow,
+			UserID:  followedID,
+			ActorID: followerID.(string),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		log.Printf("FollowUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
 		return
 	}
@@ -157,9 +181,15 @@ func (h *FollowerHandler) GetFollowers(c *gin.Context) {
 	// Get user ID from URL
 	userID := c.Param("id")
 
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
 	// Check if user exists
 	var userExists bool
-	err := h.db.Get(&userExists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID)
+	err = h.db.Get(&userExists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -178,15 +208,16 @@ func (h *FollowerHandler) GetFollowers(c *gin.Context) {
 
 	// Get followers with their follow status relative to current user
 	type FollowerWithStatus struct {
-		ID             string `json:"id" db:"id"`
-		Username       string `json:"username" db:"username"`
-		Name           string `json:"name" db:"name"`
-		ProfilePicture string `json:"profilePicture" db:"profile_picture"`
-		IsFollowing    bool   `json:"isFollowing" db:"is_following"`
-		IsFollowedBy   bool   `json:"isFollowedBy" db:"is_followed_by"`
+		ID             string    `json:"id" db:"id"`
+		Username       string    `json:"username" db:"username"`
+		Name           string    `json:"name" db:"name"`
+		ProfilePicture string    `json:"profilePicture" db:"profile_picture"`
+		IsFollowing    bool      `json:"isFollowing" db:"is_following"`
+		IsFollowedBy   bool      `json:"isFollowedBy" db:"is_followed_by"`
+		FollowedAt     time.Time `json:"followedAt" db:"followed_at"`
 	}
 
-	var followers []FollowerWithStatus
+	followers := []FollowerWithStatus{}
 	var query string
 	var args []interface{}
 
@@ -197,17 +228,19 @@ func (h *FollowerHandler) GetFollowers(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name, 
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				EXISTS(SELECT 1 FROM followers WHERE follower_id = $2 AND followed_id = u.id) as is_following,
-				EXISTS(SELECT 1 FROM followers WHERE follower_id = u.id AND followed_id = $2) as is_followed_by
+				EXISTS(SELECT 1 FROM followers WHERE follower_id = u.id AND followed_id = $2) as is_followed_by,
+				f.created_at as followed_at
 			FROM 
 				users u
 			JOIN 
 				followers f ON u.id = f.follower_id 
 			WHERE 
-				f.followed_id = $1
+				f.followed_id = $1 AND %s
 			ORDER BY 
-				f.created_at DESC
+				f.created_at DESC, u.id DESC
+			LIMIT $%d
 		`
 		args = []interface{}{userID, *currentUserID}
 	} else {
@@ -217,29 +250,46 @@ func (h *FollowerHandler) GetFollowers(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name, 
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				false as is_following,
-				false as is_followed_by
+				false as is_followed_by,
+				f.created_at as followed_at
 			FROM 
 				users u
 			JOIN 
 				followers f ON u.id = f.follower_id 
 			WHERE 
-				f.followed_id = $1
+				f.followed_id = $1 AND %s
 			ORDER BY 
-				f.created_at DESC
+				f.created_at DESC, u.id DESC
+			LIMIT $%d
 		`
 		args = []interface{}{userID}
 	}
 
-	err = h.db.Select(&followers, query, args...)
+	// Apply the page cursor, fetching one extra row to know whether another page exists
+	condition, args := cursorCondition(cursor, "f.created_at", "u.id", args)
+	args = append(args, limit+1)
+
+	err = h.db.Select(&followers, fmt.Sprintf(query, condition, len(args)), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get followers"})
 		return
 	}
 
+	nextCursor := ""
+	if len(followers) > limit {
+		followers = followers[:limit]
+		last := followers[limit-1]
+		nextCursor = encodeCursor(last.FollowedAt, last.ID)
+	}
+	urls := h.urls.Batch(c.Request.Context())
+	for i := range followers {
+		followers[i].ProfilePicture = urls.URL(followers[i].ProfilePicture)
+	}
+
 	// Return followers
-	c.JSON(http.StatusOK, followers)
+	c.JSON(http.StatusOK, models.Page{Items: followers, NextCursor: nextCursor})
 }
 
 // GetFollowing returns users followed by a specific user
@@ -247,9 +297,15 @@ func (h *FollowerHandler) GetFollowing(c *gin.Context) {
 	// Get user ID from URL
 	userID := c.Param("id")
 
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
 	// Check if user exists
 	var userExists bool
-	err := h.db.Get(&userExists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID)
+	err = h.db.Get(&userExists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -268,15 +324,16 @@ func (h *FollowerHandler) GetFollowing(c *gin.Context) {
 
 	// Get following with their follow status relative to current user
 	type FollowingWithStatus struct {
-		ID             string `json:"id" db:"id"`
-		Username       string `json:"username" db:"username"`
-		Name           string `json:"name" db:"name"`
-		ProfilePicture string `json:"profilePicture" db:"profile_picture"`
-		IsFollowing    bool   `json:"isFollowing" db:"is_following"`
-		IsFollowedBy   bool   `json:"isFollowedBy" db:"is_followed_by"`
+		ID             string    `json:"id" db:"id"`
+		Username       string    `json:"username" db:"username"`
+		Name           string    `json:"name" db:"name"`
+		ProfilePicture string    `json:"profilePicture" db:"profile_picture"`
+		IsFollowing    bool      `json:"isFollowing" db:"is_following"`
+		IsFollowedBy   bool      `json:"isFollowedBy" db:"is_followed_by"`
+		FollowedAt     time.Time `json:"followedAt" db:"followed_at"`
 	}
 
-	var following []FollowingWithStatus
+	following := []FollowingWithStatus{}
 	var query string
 	var args []interface{}
 
@@ -287,17 +344,19 @@ func (h *FollowerHandler) GetFollowing(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name, 
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				EXISTS(SELECT 1 FROM followers WHERE follower_id = $2 AND followed_id = u.id) as is_following,
-				EXISTS(SELECT 1 FROM followers WHERE follower_id = u.id AND followed_id = $2) as is_followed_by
+				EXISTS(SELECT 1 FROM followers WHERE follower_id = u.id AND followed_id = $2) as is_followed_by,
+				f.created_at as followed_at
 			FROM 
 				users u
 			JOIN 
 				followers f ON u.id = f.followed_id 
 			WHERE 
-				f.follower_id = $1
+				f.follower_id = $1 AND %s
 			ORDER BY 
-				f.created_at DESC
+				f.created_at DESC, u.id DESC
+			LIMIT $%d
 		`
 		args = []interface{}{userID, *currentUserID}
 	} else {
@@ -307,29 +366,46 @@ func (h *FollowerHandler) GetFollowing(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name, 
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				false as is_following,
-				false as is_followed_by
+				false as is_followed_by,
+				f.created_at as followed_at
 			FROM 
 				users u
 			JOIN 
 				followers f ON u.id = f.followed_id 
 			WHERE 
-				f.follower_id = $1
+				f.follower_id = $1 AND %s
 			ORDER BY 
-				f.created_at DESC
+				f.created_at DESC, u.id DESC
+			LIMIT $%d
 		`
 		args = []interface{}{userID}
 	}
 
-	err = h.db.Select(&following, query, args...)
+	// Apply the page cursor, fetching one extra row to know whether another page exists
+	condition, args := cursorCondition(cursor, "f.created_at", "u.id", args)
+	args = append(args, limit+1)
+
+	err = h.db.Select(&following, fmt.Sprintf(query, condition, len(args)), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get following"})
 		return
 	}
 
+	nextCursor := ""
+	if len(following) > limit {
+		following = following[:limit]
+		last := following[limit-1]
+		nextCursor = encodeCursor(last.FollowedAt, last.ID)
+	}
+	urls := h.urls.Batch(c.Request.Context())
+	for i := range following {
+		following[i].ProfilePicture = urls.URL(following[i].ProfilePicture)
+	}
+
 	// Return following
-	c.JSON(http.StatusOK, following)
+	c.JSON(http.StatusOK, models.Page{Items: following, NextCursor: nextCursor})
 }
 
 // SearchUsers searches for users by username or name
@@ -340,6 +416,12 @@ func (h *FollowerHandler) SearchUsers(c *gin.Context) {
 		return
 	}
 
+	limit, cursor, err := parseKeyPageParams(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
 	// Get current user if authenticated
 	var currentUserID *string
 	if userIDValue, exists := c.Get("userID"); exists {
@@ -358,7 +440,7 @@ func (h *FollowerHandler) SearchUsers(c *gin.Context) {
 		FollowingCount int    `json:"followingCount" db:"following_count"`
 	}
 
-	var users []UserSearchResult
+	users := []UserSearchResult{}
 	var sqlQuery string
 	var args []interface{}
 
@@ -372,17 +454,17 @@ func (h *FollowerHandler) SearchUsers(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name,
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				EXISTS(SELECT 1 FROM followers WHERE follower_id = $2 AND followed_id = u.id) as is_following,
 				(SELECT COUNT(*) FROM followers WHERE followed_id = u.id) as follower_count,
 				(SELECT COUNT(*) FROM followers WHERE follower_id = u.id) as following_count
 			FROM 
 				users u
 			WHERE 
-				u.username ILIKE $1 OR u.name ILIKE $1
+				(u.username ILIKE $1 OR u.name ILIKE $1) AND %s
 			ORDER BY 
-				u.username ASC
-			LIMIT 20
+				u.username ASC, u.id ASC
+			LIMIT $%d
 		`
 		args = []interface{}{searchPattern, *currentUserID}
 	} else {
@@ -392,29 +474,45 @@ func (h *FollowerHandler) SearchUsers(c *gin.Context) {
 				u.id, 
 				u.username, 
 				COALESCE(u.name, '') as name,
-				COALESCE(u.profile_picture, '') as profile_picture,
+				COALESCE(u.profile_picture_key, '') as profile_picture,
 				false as is_following,
 				(SELECT COUNT(*) FROM followers WHERE followed_id = u.id) as follower_count,
 				(SELECT COUNT(*) FROM followers WHERE follower_id = u.id) as following_count
 			FROM 
 				users u
 			WHERE 
-				u.username ILIKE $1 OR u.name ILIKE $1
+				(u.username ILIKE $1 OR u.name ILIKE $1) AND %s
 			ORDER BY 
-				u.username ASC
-			LIMIT 20
+				u.username ASC, u.id ASC
+			LIMIT $%d
 		`
 		args = []interface{}{searchPattern}
 	}
 
-	err := h.db.Select(&users, sqlQuery, args...)
+	// Results are ordered by username rather than creation time, so the
+	// cursor carries the last username, with the ID to break ties
+	condition, args := keyCursorCondition(cursor, "u.username", "u.id", args)
+	args = append(args, limit+1)
+
+	err = h.db.Select(&users, fmt.Sprintf(sqlQuery, condition, len(args)), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
 		return
 	}
 
+	nextCursor := ""
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		nextCursor = encodeKeyCursor(last.ID, last.Username)
+	}
+	urls := h.urls.Batch(c.Request.Context())
+	for i := range users {
+		users[i].ProfilePicture = urls.URL(users[i].ProfilePicture)
+	}
+
 	// Return search results
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, models.Page{Items: users, NextCursor: nextCursor})
 }
 
 // GetFollowingPostsFeed returns posts from users the current user follows
@@ -426,53 +524,51 @@ func (h *FollowerHandler) GetFollowingPostsFeed(c *gin.Context) {
 		return
 	}
 
-	// Get posts from followed users
-	var posts []models.Post
-	err := h.db.Select(
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get posts from followed users, fetching one extra to know whether another page exists
+	condition, args := cursorCondition(cursor, "p.created_at", "p.id", []interface{}{userID})
+	args = append(args, limit+1)
+
+	posts := []models.Post{}
+	err = h.db.Select(
 		&posts,
-		`SELECT p.*, u.username 
+		fmt.Sprintf(`SELECT p.*, u.username 
 		FROM posts p 
 		JOIN users u ON p.user_id = u.id 
 		WHERE p.user_id IN (
 			SELECT followed_id 
 			FROM followers 
 			WHERE follower_id = $1
-		)
-		ORDER BY p.created_at DESC 
-		LIMIT 50`,
-		userID,
+		) AND p.status = 'ready' AND %s
+		ORDER BY p.created_at DESC, p.id DESC 
+		LIMIT $%d`, condition, len(args)),
+		args...,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
-	// Check which posts the user has liked
-	for i := range posts {
-		var liked bool
-		err := h.db.Get(&liked, "SELECT EXISTS(SELECT 1 FROM post_likes WHERE post_id = $1 AND user_id = $2)", posts[i].ID, userID)
-		if err == nil {
-			posts[i].Liked = liked
-		}
-	}
-
-	// Get comments for each post
-	for i := range posts {
-		err := h.db.Select(
-			&posts[i].Comments,
-			`SELECT c.*, u.username 
-			FROM comments c 
-			JOIN users u ON c.user_id = u.id 
-			WHERE c.post_id = $1 
-			ORDER BY c.created_at ASC`,
-			posts[i].ID,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
-			return
-		}
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	// Load like status and comment previews for the whole page
+	if err := assembleFeed(h.db, posts, userID.(string)); err != nil {
+		log.Printf("GetFollowingPostsFeed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
 	}
 
 	// Return posts
-	c.JSON(http.StatusOK, posts)
+	renderPosts(h.urls.Batch(c.Request.Context()), posts)
+	c.JSON(http.StatusOK, models.Page{Items: posts, NextCursor: nextCursor})
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/services/entities"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetHashtagPosts returns a page of posts whose caption has a hashtag, newest
+// first. The tag may be given with or without its #, in any case.
+func (h *PostHandler) GetHashtagPosts(c *gin.Context) {
+	tag := entities.NormalizeHashtag(c.Param("tag"))
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hashtag"})
+		return
+	}
+
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get posts, fetching one extra to know whether another page exists
+	visible, args := visibleCondition(viewerID(c), []interface{}{tag})
+	condition, args := cursorCondition(cursor, "p.created_at", "p.id", args)
+	args = append(args, limit+1)
+
+	posts := []models.Post{}
+	err = h.db.Select(
+		&posts,
+		fmt.Sprintf(`SELECT p.*, u.username
+		FROM post_hashtags ph
+		JOIN posts p ON ph.post_id = p.id
+		JOIN users u ON p.user_id = u.id
+		WHERE ph.tag = $1 AND %s AND %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $%d`, visible, condition, len(args)),
+		args...,
+	)
+	if err != nil {
+		log.Printf("GetHashtagPosts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
+		return
+	}
+
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	// Load like status and comment previews for the whole page
+	if err := assembleFeed(h.db, posts, viewerID(c)); err != nil {
+		log.Printf("GetHashtagPosts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
+	}
+
+	// Return posts
+	renderPosts(h.urls.Batch(c.Request.Context()), posts)
+	c.JSON(http.StatusOK, models.Page{Items: posts, NextCursor: nextCursor})
+}
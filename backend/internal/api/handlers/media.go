@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/storage"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// loadPostMedia fills in every media item and image rendition of the given posts
+func loadPostMedia(q sqlx.Queryer, posts ...*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]string, len(posts))
+	index := make(map[string]*models.Post, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+		index[post.ID] = post
+		post.Media = nil
+	}
+
+	var items []models.PostMedia
+	err := sqlx.Select(
+		q,
+		&items,
+		"SELECT * FROM post_media WHERE post_id = ANY($1) ORDER BY post_id, position",
+		pq.Array(postIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get post media: %w", err)
+	}
+
+	var renditions []models.Rendition
+	err = sqlx.Select(
+		q,
+		&renditions,
+		"SELECT * FROM media_renditions WHERE post_id = ANY($1) ORDER BY post_id, position, content_type, width",
+		pq.Array(postIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get image renditions: %w", err)
+	}
+
+	for _, item := range items {
+		post := index[item.PostID]
+		post.Media = append(post.Media, item)
+	}
+	for _, rendition := range renditions {
+		post := index[rendition.PostID]
+		for i := range post.Media {
+			if post.Media[i].Position == rendition.Position {
+				post.Media[i].Renditions = append(post.Media[i].Renditions, rendition)
+			}
+		}
+	}
+
+	// The post's own renditions are its cover's
+	for _, post := range posts {
+		post.Renditions = nil
+		if len(post.Media) > 0 {
+			post.Renditions = post.Media[0].Renditions
+		}
+	}
+	return nil
+}
+
+// renderPosts fills in the media URLs of a page of posts from their keys
+func renderPosts(urls *storage.URLBatch, posts []models.Post) {
+	for i := range posts {
+		renderPost(urls, &posts[i])
+	}
+}
+
+// renderPost fills in a post's media URLs from its stored object keys
+func renderPost(urls *storage.URLBatch, post *models.Post) {
+	post.MediaURL = urls.URL(post.MediaKey)
+	post.ThumbnailURL = renderKey(urls, post.ThumbnailKey)
+	post.PlaylistURL = renderKey(urls, post.PlaylistKey)
+	for i := range post.Media {
+		item := &post.Media[i]
+		item.MediaURL = urls.URL(item.MediaKey)
+		item.ThumbnailURL = renderKey(urls, item.ThumbnailKey)
+		item.PlaylistURL = renderKey(urls, item.PlaylistKey)
+		renderRenditions(urls, item.Renditions)
+	}
+	renderRenditions(urls, post.Renditions)
+}
+
+// renderRenditions fills in the URLs of image renditions
+func renderRenditions(urls *storage.URLBatch, renditions []models.Rendition) {
+	for i := range renditions {
+		renditions[i].URL = urls.URL(renditions[i].MediaKey)
+	}
+}
+
+// renderKey returns the URL for an optional object key, or nil if it is unset
+func renderKey(urls *storage.URLBatch, key *string) *string {
+	if key == nil || *key == "" {
+		return nil
+	}
+	url := urls.URL(*key)
+	return &url
+}
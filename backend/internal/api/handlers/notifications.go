@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/services/notifications"
+	"backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Most actors returned with each notification
+const maxNotificationActors = 3
+
+// Notifications are shown while they have an actor left and aren't about a
+// post that has been taken down or isn't ready yet
+const visibleNotification = `EXISTS(SELECT 1 FROM notification_actors na WHERE na.notification_id = n.id)
+	AND (n.post_id IS NULL OR EXISTS(SELECT 1 FROM posts p WHERE p.id = n.post_id AND p.status = 'ready'))`
+
+// NotificationHandler handles notification-related requests
+type NotificationHandler struct {
+	db   *sqlx.DB
+	urls *storage.URLSigner
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(db *sqlx.DB, urls *storage.URLSigner) *NotificationHandler {
+	return &NotificationHandler{
+		db:   db,
+		urls: urls,
+	}
+}
+
+// GetNotifications returns a page of the current user's notifications, most
+// recently updated first
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	limit, cursor, err := parsePageParams(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get notifications, fetching one extra to know whether another page exists
+	condition, args := cursorCondition(cursor, "n.updated_at", "n.id", []interface{}{userID})
+	args = append(args, limit+1)
+
+	items := []models.Notification{}
+	err = h.db.Select(
+		&items,
+		fmt.Sprintf(`SELECT n.*, (SELECT COUNT(*) FROM notification_actors na WHERE na.notification_id = n.id) AS actor_count
+		FROM notifications n
+		WHERE n.user_id = $1 AND %s AND %s
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $%d`, visibleNotification, condition, len(args)),
+		args...,
+	)
+	if err != nil {
+		log.Printf("GetNotifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	nextCursor := ""
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[limit-1]
+		nextCursor = encodeCursor(last.UpdatedAt, last.ID)
+	}
+
+	if err := loadNotificationActors(h.db, items); err != nil {
+		log.Printf("GetNotifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	urls := h.urls.Batch(c.Request.Context())
+	for i := range items {
+		for j := range items[i].Actors {
+			items[i].Actors[j].ProfilePicture = urls.URL(items[i].Actors[j].ProfilePicture)
+		}
+		items[i].Message = notifications.Message(items[i])
+		items[i].Read = items[i].ReadAt != nil
+	}
+
+	c.JSON(http.StatusOK, models.Page{Items: items, NextCursor: nextCursor})
+}
+
+// GetUnreadCount returns how many of the current user's notifications are unread
+func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
+	count, err := unreadNotifications(h.db, c.GetString("userID"))
+	if err != nil {
+		log.Printf("GetUnreadCount: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unreadCount": count})
+}
+
+// MarkRead marks one of the current user's notifications as read
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	result, err := h.db.Exec(
+		"UPDATE notifications SET read_at = COALESCE(read_at, $1) WHERE id = $2 AND user_id = $3",
+		time.Now(), c.Param("id"), userID,
+	)
+	if err != nil {
+		log.Printf("MarkRead: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	count, err := unreadNotifications(h.db, userID)
+	if err != nil {
+		log.Printf("MarkRead: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Notification marked as read",
+		"unreadCount": count,
+	})
+}
+
+// MarkAllRead marks all of the current user's notifications as read
+func (h *NotificationHandler) MarkAllRead(c *gin.Context) {
+	_, err := h.db.Exec(
+		"UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL",
+		time.Now(), c.GetString("userID"),
+	)
+	if err != nil {
+		log.Printf("MarkAllRead: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "All notifications marked as read",
+		"unreadCount": 0,
+	})
+}
+
+// unreadNotifications counts a user's unread notifications that would be listed
+func unreadNotifications(q sqlx.Queryer, userID string) (int, error) {
+	var count int
+	err := sqlx.Get(
+		q, &count,
+		fmt.Sprintf("SELECT COUNT(*) FROM notifications n WHERE n.user_id = $1 AND n.read_at IS NULL AND %s", visibleNotification),
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// loadNotificationActors fills in the most recent actors of each notification
+func loadNotificationActors(q sqlx.Queryer, items []models.Notification) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	var actors []models.NotificationActor
+	err := sqlx.Select(
+		q, &actors,
+		`SELECT notification_id, id, username, profile_picture
+		FROM (
+			SELECT na.notification_id, u.id, u.username, COALESCE(u.profile_picture_key, '') AS profile_picture,
+				na.created_at, ROW_NUMBER() OVER (PARTITION BY na.notification_id ORDER BY na.created_at DESC) AS actor_rank
+			FROM notification_actors na
+			JOIN users u ON na.user_id = u.id
+			WHERE na.notification_id = ANY($1)
+		) ranked
+		WHERE actor_rank <= $2
+		ORDER BY notification_id, created_at DESC`,
+		pq.Array(ids), maxNotificationActors,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get notification actors: %w", err)
+	}
+
+	byNotification := make(map[string][]models.NotificationActor, len(items))
+	for _, actor := range actors {
+		byNotification[actor.NotificationID] = append(byNotification[actor.NotificationID], actor)
+	}
+	for i := range items {
+		items[i].Actors = byNotification[items[i].ID]
+	}
+	return nil
+}
+
+// notifyMentions tells newly mentioned users about a post or, if commentID is
+// set, a comment
+func notifyMentions(tx sqlx.Ext, actorID, postID, commentID string, userIDs []string) error {
+	for _, userID := range userIDs {
+		err := notifications.Notify(tx, notifications.Event{
+			Type:      models.NotificationMention,
+			UserID:    userID,
+			ActorID:   actorID,
+			PostID:    postID,
+			CommentID: commentID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyComment tells the post's owner about a new comment, or for a reply the
+// author of the comment replied to, and newly mentioned users about either.
+// Nobody is told twice about the same comment.
+func notifyComment(tx sqlx.Ext, postID, commentID, actorID string, parent *models.Comment, mentioned []string) error {
+	event := notifications.Event{
+		Type:      models.NotificationComment,
+		ActorID:   actorID,
+		PostID:    postID,
+		CommentID: commentID,
+	}
+	if parent != nil {
+		event.Type = models.NotificationReply
+		event.UserID = *parent.UserID // Replies are never to tombstones
+		event.CommentID = parent.ID
+	} else if err := sqlx.Get(tx, &event.UserID, "SELECT user_id FROM posts WHERE id = $1", postID); err != nil {
+		return fmt.Errorf("failed to get post owner: %w", err)
+	}
+	if err := notifications.Notify(tx, event); err != nil {
+		return err
+	}
+
+	var others []string
+	for _, userID := range mentioned {
+		if userID != event.UserID {
+			others = append(others, userID)
+		}
+	}
+	return notifyMentions(tx, actorID, postID, commentID, others)
+}
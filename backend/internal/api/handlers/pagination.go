@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum number of items a client may request in a single page
+const maxPageLimit = 100
+
+// pageCursor marks the last item of a page. It is handed to clients as an
+// opaque string and passed back to fetch the next page.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// encodeCursor builds the opaque cursor string for an item
+func encodeCursor(createdAt time.Time, id string) string {
+	raw := createdAt.Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor previously produced by encodeCursor
+func decodeCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errors.New("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &pageCursor{CreatedAt: createdAt, ID: parts[1]}, nil
+}
+
+// keyCursor marks the last item of a page of a listing ordered by a text
+// column and then ID, such as users by username
+type keyCursor struct {
+	ID  string
+	Key string
+}
+
+// encodeKeyCursor builds the opaque cursor string for an item of a listing
+// ordered by key. The key is stored itself rather than looked up again by ID,
+// so the cursor still works if the item has since been deleted.
+func encodeKeyCursor(id, key string) string {
+	raw := id + "|" + key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeKeyCursor parses a cursor previously produced by encodeKeyCursor
+func decodeKeyCursor(value string) (*keyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	// IDs never contain the separator, keys may
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &keyCursor{ID: parts[0], Key: parts[1]}, nil
+}
+
+// parseLimit reads the `limit` query parameter, capped at maxPageLimit
+func parseLimit(c *gin.Context, defaultLimit int) (int, error) {
+	limit := defaultLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, errors.New("invalid limit")
+		}
+		limit = parsed
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
+
+// parseKeyPageParams is parsePageParams for listings paged with keyCursor
+func parseKeyPageParams(c *gin.Context, defaultLimit int) (int, *keyCursor, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var cursor *keyCursor
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := decodeKeyCursor(value)
+		if err != nil {
+			return 0, nil, errors.New("invalid cursor")
+		}
+		cursor = parsed
+	}
+
+	return limit, cursor, nil
+}
+
+// parsePageParams reads the `limit` and `cursor` query parameters.
+// The cursor is nil when the client is requesting the first page.
+func parsePageParams(c *gin.Context, defaultLimit int) (int, *pageCursor, error) {
+	limit, err := parseLimit(c, defaultLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var cursor *pageCursor
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := decodeCursor(value)
+		if err != nil {
+			return 0, nil, errors.New("invalid cursor")
+		}
+		cursor = parsed
+	}
+
+	return limit, cursor, nil
+}
+
+// cursorCondition returns a keyset condition for a newest-first listing
+// ordered by (createdAtColumn DESC, idColumn DESC), appending its arguments
+// to args. Without a cursor it returns a condition that matches every row.
+func cursorCondition(cursor *pageCursor, createdAtColumn, idColumn string, args []interface{}) (string, []interface{}) {
+	if cursor == nil {
+		return "TRUE", args
+	}
+
+	args = append(args, cursor.CreatedAt, cursor.ID)
+	condition := fmt.Sprintf("(%s, %s) < ($%d, $%d)", createdAtColumn, idColumn, len(args)-1, len(args))
+	return condition, args
+}
+
+// keyCursorCondition returns a keyset condition for a listing ordered by
+// (keyColumn ASC, idColumn ASC), appending its arguments to args. Without a
+// cursor it returns a condition that matches every row.
+func keyCursorCondition(cursor *keyCursor, keyColumn, idColumn string, args []interface{}) (string, []interface{}) {
+	if cursor == nil {
+		return "TRUE", args
+	}
+
+	args = append(args, cursor.Key, cursor.ID)
+	condition := fmt.Sprintf("(%s, %s) > ($%d, $%d)", keyColumn, idColumn, len(args)-1, len(args))
+	return condition, args
+}
+
+// ascendingCursorCondition is cursorCondition for an oldest-first listing
+// ordered by (createdAtColumn ASC, idColumn ASC)
+func ascendingCursorCondition(cursor *pageCursor, createdAtColumn, idColumn string, args []interface{}) (string, []interface{}) {
+	if cursor == nil {
+		return "TRUE", args
+	}
+
+	args = append(args, cursor.CreatedAt, cursor.ID)
+	condition := fmt.Sprintf("(%s, %s) > ($%d, $%d)", createdAtColumn, idColumn, len(args)-1, len(args))
+	return condition, args
+}
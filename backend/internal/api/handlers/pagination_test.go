@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func rawCursor(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	times := []time.Time{
+		time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC),
+		time.Date(1999, 12, 31, 23, 59, 59, 0, time.FixedZone("EST", -5*60*60)),
+	}
+
+	for _, createdAt := range times {
+		cursor, err := decodeCursor(encodeCursor(createdAt, testFileID))
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%v)) error = %v", createdAt, err)
+		}
+		if !cursor.CreatedAt.Equal(createdAt) || cursor.ID != testFileID {
+			t.Errorf("decodeCursor(encodeCursor(%v, %q)) = %+v", createdAt, testFileID, cursor)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not base64!"},
+		{"no separator", rawCursor("2024-03-01T12:00:00Z")},
+		{"no id", rawCursor("2024-03-01T12:00:00Z|")},
+		{"bad time", rawCursor("yesterday|" + testFileID)},
+		{"empty", rawCursor("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeCursor(tt.value); err == nil {
+				t.Errorf("decodeCursor(%q) = %+v, want an error", tt.value, cursor)
+			}
+		})
+	}
+}
+
+func TestKeyCursorRoundTrip(t *testing.T) {
+	keys := []string{"alice", "bob.smith", "pipe|in|key", "ünïcödé", "a"}
+
+	for _, key := range keys {
+		cursor, err := decodeKeyCursor(encodeKeyCursor(testUserID, key))
+		if err != nil {
+			t.Fatalf("decodeKeyCursor(encodeKeyCursor(%q)) error = %v", key, err)
+		}
+		want := &keyCursor{ID: testUserID, Key: key}
+		if !reflect.DeepEqual(cursor, want) {
+			t.Errorf("decodeKeyCursor(encodeKeyCursor(%q)) = %+v, want %+v", key, cursor, want)
+		}
+	}
+}
+
+func TestDecodeKeyCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not base64!"},
+		{"no separator", rawCursor("alice")},
+		{"no id", rawCursor("|alice")},
+		{"no key", rawCursor(testUserID + "|")},
+		{"empty", rawCursor("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeKeyCursor(tt.value); err == nil {
+				t.Errorf("decodeKeyCursor(%q) = %+v, want an error", tt.value, cursor)
+			}
+		})
+	}
+}
+
+func TestKeyCursorCondition(t *testing.T) {
+	args := []interface{}{"%al%"}
+
+	condition, got := keyCursorCondition(nil, "u.username", "u.id", args)
+	if condition != "TRUE" || len(got) != 1 {
+		t.Errorf("keyCursorCondition(nil) = %q, %v", condition, got)
+	}
+
+	cursor := &keyCursor{ID: testUserID, Key: "alice"}
+	condition, got = keyCursorCondition(cursor, "u.username", "u.id", args)
+	if want := "(u.username, u.id) > ($2, $3)"; condition != want {
+		t.Errorf("keyCursorCondition() = %q, want %q", condition, want)
+	}
+	if want := []interface{}{"%al%", "alice", testUserID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keyCursorCondition() args = %v, want %v", got, want)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query string
+		want  int
+		err   bool
+	}{
+		{"", 20, false},
+		{"limit=5", 5, false},
+		{"limit=1", 1, false},
+		{"limit=100", 100, false},
+		{"limit=1000", maxPageLimit, false},
+		{"limit=0", 0, true},
+		{"limit=-3", 0, true},
+		{"limit=ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+		got, err := parseLimit(c, 20)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseLimit(%q) = %d, %v; want %d, error %v", tt.query, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"path"
 	"strings"
 	"time"
 
 	"backend/internal/models"
-	"backend/internal/services/compression"
+	"backend/internal/services/jobs"
+	"backend/internal/services/media"
+	"backend/internal/services/notifications"
 	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
@@ -21,65 +26,68 @@ import (
 
 // PostHandler handles post-related requests
 type PostHandler struct {
-	db       *sqlx.DB
-	s3Client *storage.S3Client
+	db        *sqlx.DB
+	blob      storage.Blob
+	urls      *storage.URLSigner
+	validator *media.Validator
 }
 
 // NewPostHandler creates a new post handler
-func NewPostHandler(db *sqlx.DB, s3Client *storage.S3Client) *PostHandler {
+func NewPostHandler(db *sqlx.DB, blob storage.Blob, urls *storage.URLSigner, validator *media.Validator) *PostHandler {
 	return &PostHandler{
-		db:       db,
-		s3Client: s3Client,
+		db:        db,
+		blob:      blob,
+		urls:      urls,
+		validator: validator,
 	}
 }
 
-// GetPosts returns all posts
+// GetPosts returns a page of posts, newest first
 func (h *PostHandler) GetPosts(c *gin.Context) {
-	// Get posts
-	var posts []models.Post
-	err := h.db.Select(
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Get posts, fetching one extra to know whether another page exists
+	visible, args := visibleCondition(viewerID(c), nil)
+	condition, args := cursorCondition(cursor, "p.created_at", "p.id", args)
+	args = append(args, limit+1)
+
+	posts := []models.Post{}
+	err = h.db.Select(
 		&posts,
-		`SELECT p.*, u.username 
+		fmt.Sprintf(`SELECT p.*, u.username 
 		FROM posts p 
 		JOIN users u ON p.user_id = u.id 
-		ORDER BY p.created_at DESC 
-		LIMIT 50`,
+		WHERE %s AND %s
+		ORDER BY p.created_at DESC, p.id DESC 
+		LIMIT $%d`, visible, condition, len(args)),
+		args...,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
-	if userID, exists := c.Get("userID"); exists {
-		// Check which posts the user has liked
-		for i := range posts {
-			var liked bool
-			err := h.db.Get(&liked, "SELECT EXISTS(SELECT 1 FROM post_likes WHERE post_id = $1 AND user_id = $2)", posts[i].ID, userID)
-			if err == nil {
-				posts[i].Liked = liked
-			}
-		}
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
 	}
 
-	// Get comments for each post
-	for i := range posts {
-		err := h.db.Select(
-			&posts[i].Comments,
-			`SELECT c.*, u.username 
-			FROM comments c 
-			JOIN users u ON c.user_id = u.id 
-			WHERE c.post_id = $1 
-			ORDER BY c.created_at ASC`,
-			posts[i].ID,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
-			return
-		}
+	// Load like status and comment previews for the whole page
+	if err := assembleFeed(h.db, posts, viewerID(c)); err != nil {
+		log.Printf("GetPosts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
 	}
 
 	// Return posts
-	c.JSON(http.StatusOK, posts)
+	renderPosts(h.urls.Batch(c.Request.Context()), posts)
+	c.JSON(http.StatusOK, models.Page{Items: posts, NextCursor: nextCursor})
 }
 
 // GetPost returns a specific post
@@ -96,12 +104,19 @@ func (h *PostHandler) GetPost(c *gin.Context) {
 		WHERE p.id = $1`,
 		postID,
 	)
-	if err != nil {
+	if err != nil || !canViewPost(post, viewerID(c)) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	// Similarly in GetPost method, after fetching the post
+	// Get media items
+	if err := loadPostMedia(h.db, &post); err != nil {
+		log.Printf("GetPost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post media"})
+		return
+	}
+
+	// Check whether the viewer has liked the post
 	if userID, exists := c.Get("userID"); exists {
 		var liked bool
 		err := h.db.Get(&liked, "SELECT EXISTS(SELECT 1 FROM post_likes WHERE post_id = $1 AND user_id = $2)", post.ID, userID)
@@ -110,22 +125,21 @@ func (h *PostHandler) GetPost(c *gin.Context) {
 		}
 	}
 
-	// Get comments
-	err = h.db.Select(
-		&post.Comments,
-		`SELECT c.*, u.username 
-		FROM comments c 
-		JOIN users u ON c.user_id = u.id 
-		WHERE c.post_id = $1 
-		ORDER BY c.created_at ASC`,
-		postID,
-	)
-	if err != nil {
+	// Get top-level comments in the requested order; replies are loaded per thread
+	sort := c.DefaultQuery("sort", "oldest")
+	order, ok := commentOrders[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, use newest, oldest or top"})
+		return
+	}
+	if err := loadComments(h.db, &post, viewerID(c), order); err != nil {
+		log.Printf("GetPost: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
 		return
 	}
 
 	// Return post
+	renderPost(h.urls.Batch(c.Request.Context()), &post)
 	c.JSON(http.StatusOK, post)
 }
 
@@ -137,146 +151,166 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		return
 	}
 
+	// Cap the request at the most a full post of the largest allowed files
+	// could need, before any of it is read
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(models.MaxPostMedia)*h.validator.MaxBytes()+multipartOverhead)
+
 	// Parse form data
+	var files []*multipart.FileHeader
+	form, err := c.MultipartForm()
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload is too large"})
+		return
+	}
+	if err == nil {
+		files = form.File["file"]
+	}
 	caption := c.PostForm("caption")
-	file, err := c.FormFile("file")
-	if err != nil {
+
+	// The media either was uploaded directly to storage beforehand (see
+	// CreateUpload) or is sent as multipart files, which are staged the same
+	// way. Items keep the order they were sent in.
+	payload := media.ProcessPostPayload{PostID: uuid.New().String()}
+	var staged []string
+	deleteStaged := func() {
+		for _, key := range staged {
+			if err := h.blob.Delete(c.Request.Context(), key); err != nil {
+				log.Printf("Warning: Failed to delete staged upload: %v, key: %s", err, key)
+			}
+		}
+	}
+
+	uploadKeys := c.PostFormArray("uploadKey")
+	switch {
+	case len(uploadKeys) > 0 && len(files) > 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send either files or upload keys, not both"})
+		return
+	case len(uploadKeys) == 0 && len(files) == 0:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
+	case len(uploadKeys) > models.MaxPostMedia || len(files) > models.MaxPostMedia:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A post can have at most %d media items", models.MaxPostMedia)})
+		return
 	}
 
-	// Open file
-	src, err := file.Open()
+	// Find mentions and hashtags in the caption
+	captionEntities, err := parseEntities(h.db, caption)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
+		log.Printf("CreatePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	defer src.Close()
 
-	// Read file into memory
-	fileData := make([]byte, file.Size)
-	_, err = src.Read(fileData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
-		return
-	}
-
-	// Determine content type and handle iOS specific formats
-	contentType := file.Header.Get("Content-Type")
-
-	// If content type is missing or generic, try to detect from file extension
-	if contentType == "" || contentType == "application/octet-stream" {
-		ext := strings.ToLower(filepath.Ext(file.Filename))
-		switch ext {
-		case ".jpg", ".jpeg":
-			contentType = "image/jpeg"
-		case ".png":
-			contentType = "image/png"
-		case ".webp":
-			contentType = "image/webp"
-		case ".heic", ".heif":
-			contentType = "image/heic"
-		case ".mp4":
-			contentType = "video/mp4"
-		case ".webm":
-			contentType = "video/webm"
-		case ".mov":
-			contentType = "video/quicktime"
+	for _, uploadKey := range uploadKeys {
+		if !validStagingKey(userID.(string), uploadKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload key"})
+			return
 		}
+		payload.Items = append(payload.Items, media.StagedItem{
+			UploadKey: uploadKey,
+			FileName:  path.Base(uploadKey),
+		})
 	}
 
-	// Determine media type (image or video)
-	mediaType := "image"
-	if strings.HasPrefix(contentType, "video/") {
-		mediaType = "video"
-
-		// Handle iOS video formats like MOV
-		if contentType == "video/quicktime" || contentType == "video/mov" || !compression.CheckVideoCompatibility(fileData, contentType) {
-			// Convert to MP4
-			var convertError error
-			fileData, contentType, convertError = compression.CompressVideo(fileData, contentType)
-			if convertError != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to convert video format. Please use MP4 or WebM."})
-				return
-			}
+	for _, file := range files {
+		if file.Size > h.validator.MaxBytes() {
+			deleteStaged()
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
 		}
 
-		// Create temporary directory for processing
-		tempDir, err := os.MkdirTemp("", "video_thumbnail")
+		// Read file into memory
+		fileData, err := readFormFile(file)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp directory"})
+			deleteStaged()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 			return
 		}
-		defer os.RemoveAll(tempDir)
 
-		// Write video file to temp directory
-		inputPath := filepath.Join(tempDir, file.Filename)
-		if err := os.WriteFile(inputPath, fileData, 0644); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write temp file"})
+		// Identify the file by its content and check it against the limits for
+		// its type; the declared type and extension are not trusted
+		contentType, err := h.validator.Validate(c.Request.Context(), fileData, file.Filename)
+		if err != nil {
+			deleteStaged()
+			c.JSON(validationStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
-		// Generate thumbnail
-		thumbnailPath := filepath.Join(tempDir, "thumbnail.jpg")
-		thumbnailCmd := exec.Command(
-			"ffmpeg",
-			"-i", inputPath,
-			"-ss", "00:00:01", // Extract frame at 1 second
-			"-vframes", "1",
-			"-f", "image2",
-			thumbnailPath,
-		)
-
-		if err := thumbnailCmd.Run(); err != nil {
-			// Log error but continue with upload
-			log.Printf("Failed to generate thumbnail: %v", err)
-		} else {
-			// Read the thumbnail
-			thumbnailData, err := os.ReadFile(thumbnailPath)
-			if err == nil {
-				// Upload thumbnail to S3
-				thumbnailURL, err := h.s3Client.UploadFile(
-					c.Request.Context(),
-					thumbnailData,
-					"thumbnail_"+file.Filename+".jpg",
-					"image/jpeg",
-				)
-
-				if err == nil {
-					// Store thumbnail URL in database alongside the video
-					// This will require adding a thumbnail_url field to your posts table
-					// For now, just log it
-					log.Printf("Generated thumbnail at: %s", thumbnailURL)
+		// Reject copies of blocked images and of the user's own posts. Videos
+		// and direct uploads are only checked by the worker, which keeps
+		// ffmpeg off the request and fails the post if they match.
+		if strings.HasPrefix(contentType, "image/") {
+			hashes, err := media.HashImage(c.Request.Context(), fileData)
+			if err != nil {
+				// The worker hashes the file again and fails the post if it matches
+				log.Printf("CreatePost: failed to hash upload: %v", err)
+			}
+			if err := h.validator.CheckHashes(h.db, userID.(string), hashes); err != nil {
+				deleteStaged()
+				var validationErr *media.ValidationError
+				if errors.As(err, &validationErr) {
+					c.JSON(validationStatus(err), gin.H{"error": err.Error()})
+					return
 				}
+				log.Printf("CreatePost: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
 			}
 		}
-	} else {
-		// Compress and possibly convert the image
-		compressedData, err := compression.CompressImage(fileData, contentType)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image: " + err.Error()})
+
+		item := media.StagedItem{
+			FileName:    file.Filename,
+			ContentType: contentType,
+		}
+
+		// Store the raw upload for the worker to process
+		item.UploadKey = newStagingKey(userID.(string), file.Filename)
+		if _, err := h.blob.Upload(c.Request.Context(), item.UploadKey, fileData, item.ContentType); err != nil {
+			deleteStaged()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
 			return
 		}
-		fileData = compressedData
-		contentType = "image/jpeg" // CompressImage now always returns JPEG
+		staged = append(staged, item.UploadKey)
+		payload.Items = append(payload.Items, item)
 	}
 
-	// Upload to S3
-	mediaURL, err := h.s3Client.UploadFile(c.Request.Context(), fileData, file.Filename, contentType)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
-		return
+	// The worker settles the media type once it has inspected the files; until
+	// then it is guessed from the first one
+	cover := payload.Items[0]
+	mediaType := "image"
+	if strings.HasPrefix(cover.ContentType, "video/") ||
+		strings.HasPrefix(media.ContentTypeFromExtension(cover.FileName), "video/") {
+		mediaType = "video"
 	}
 
-	// Create post
-	postID := uuid.New().String()
+	// Create the post and its processing job together
 	now := time.Now()
+	tx, err := h.db.Beginx()
+	if err != nil {
+		deleteStaged()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
 
-	_, err = h.db.Exec(
-		"INSERT INTO posts (id, user_id, caption, media_url, media_type, likes, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		postID, userID, caption, mediaURL, mediaType, 0, now, now,
+	_, err = tx.Exec(
+		"INSERT INTO posts (id, user_id, caption, caption_entities, media_key, media_type, status, likes, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		payload.PostID, userID, caption, captionEntities, "", mediaType, models.PostStatusProcessing, 0, now, now,
 	)
+	if err == nil {
+		// Mentioned users are told once the post is ready
+		_, err = saveEntities(tx, "post", payload.PostID, captionEntities)
+	}
+	if err == nil {
+		_, err = jobs.Enqueue(tx, media.ProcessPostJob, payload)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		log.Printf("CreatePost: %v", err)
+		deleteStaged()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
 		return
 	}
@@ -291,20 +325,61 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 
 	// Create post response
 	post := models.Post{
-		ID:        postID,
+		ID:        payload.PostID,
 		UserID:    userID.(string),
 		Username:  username,
 		Caption:   caption,
-		MediaURL:  mediaURL,
+		Entities:  captionEntities,
 		MediaType: mediaType,
+		Status:    models.PostStatusProcessing,
 		Likes:     0,
 		CreatedAt: now,
 		UpdatedAt: now,
 		Comments:  []models.Comment{},
 	}
 
-	// Return success
-	c.JSON(http.StatusCreated, post)
+	// Return the pending post; clients poll GetPostStatus until it is ready
+	renderPost(h.urls.Batch(c.Request.Context()), &post)
+	c.JSON(http.StatusAccepted, post)
+}
+
+// readFormFile reads an uploaded multipart file into memory
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return io.ReadAll(src)
+}
+
+// GetPostStatus reports the processing status of one of the user's posts
+func (h *PostHandler) GetPostStatus(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	postID := c.Param("id")
+
+	var post models.Post
+	err := h.db.Get(&post, "SELECT status, status_reason FROM posts WHERE id = $1 AND user_id = $2", postID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           postID,
+		"status":       post.Status,
+		"statusReason": post.StatusReason,
+	})
 }
 
 // DeletePost deletes a post
@@ -330,6 +405,13 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 		return
 	}
 
+	// The media rows go with the post, so note every item's files first
+	if err := loadPostMedia(h.db, &post); err != nil {
+		log.Printf("DeletePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Start transaction
 	tx, err := h.db.Beginx()
 	if err != nil {
@@ -366,20 +448,80 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 	}
 
 	// Delete media from S3 after the database transaction is complete
-	if post.MediaURL != "" {
-		err = h.s3Client.DeleteFile(c.Request.Context(), post.MediaURL)
-		if err != nil {
-			// Log error but don't fail the request
-			log.Printf("Warning: Failed to delete file from S3: %v, URL: %s", err, post.MediaURL)
-		} else {
-			log.Printf("Successfully deleted file from S3 for post %s", postID)
-		}
-	}
+	deletePostMedia(c.Request.Context(), h.blob, post)
 
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
 
+// getUserPostMedia returns every post of a user with its media items loaded,
+// so their files can be removed with deletePostMedia once the rows are gone
+func getUserPostMedia(tx *sqlx.Tx, userID string) ([]models.Post, error) {
+	var posts []models.Post
+	err := tx.Select(&posts, "SELECT id, media_key, thumbnail_key, playlist_key FROM posts WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
+	}
+
+	postRefs := make([]*models.Post, len(posts))
+	for i := range posts {
+		postRefs[i] = &posts[i]
+	}
+	if err := loadPostMedia(tx, postRefs...); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// deletePostMedia removes every media file, thumbnail, HLS stream and image
+// rendition of a post from storage. The post's media items must have been
+// loaded. Errors are logged but not returned, since the post rows are already
+// gone by the time this runs.
+func deletePostMedia(ctx context.Context, blob storage.Blob, post models.Post) {
+	// The post's own columns duplicate its first item, and posts from before
+	// carousels may have no items at all
+	keys := []string{post.MediaKey}
+	hasPlaylist := post.PlaylistKey != nil && *post.PlaylistKey != ""
+	hasRenditions := false
+	if post.ThumbnailKey != nil {
+		keys = append(keys, *post.ThumbnailKey)
+	}
+	for _, item := range post.Media {
+		keys = append(keys, item.MediaKey)
+		if item.ThumbnailKey != nil {
+			keys = append(keys, *item.ThumbnailKey)
+		}
+		hasPlaylist = hasPlaylist || (item.PlaylistKey != nil && *item.PlaylistKey != "")
+		hasRenditions = hasRenditions || len(item.Renditions) > 0
+	}
+
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == "" || deleted[key] {
+			continue
+		}
+		deleted[key] = true
+		if err := blob.Delete(ctx, key); err != nil {
+			log.Printf("Warning: Failed to delete file from storage: %v, key: %s", err, key)
+		}
+	}
+	log.Printf("Deleted %d files from storage for post %s", len(deleted), post.ID)
+
+	// HLS streams and image renditions of every item live under the post's prefixes
+	if hasPlaylist {
+		prefix := media.HLSPrefix(post.ID)
+		if err := blob.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Warning: Failed to delete HLS stream from storage: %v, prefix: %s", err, prefix)
+		}
+	}
+	if hasRenditions {
+		prefix := media.RenditionsPrefix(post.ID)
+		if err := blob.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Warning: Failed to delete image renditions from storage: %v, prefix: %s", err, prefix)
+		}
+	}
+}
+
 // AddComment adds a comment to a post
 func (h *PostHandler) AddComment(c *gin.Context) {
 	// Get user ID from context
@@ -393,7 +535,8 @@ func (h *PostHandler) AddComment(c *gin.Context) {
 
 	// Parse request
 	var req struct {
-		Content string `json:"content" binding:"required"`
+		Content         string `json:"content" binding:"required"`
+		ParentCommentID string `json:"parentCommentId"` // Set for replies
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -403,7 +546,7 @@ func (h *PostHandler) AddComment(c *gin.Context) {
 
 	// Check if post exists
 	var postExists bool // Fixed: renamed 'exists' to 'postExists'
-	err := h.db.Get(&postExists, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1)", postID)
+	err := h.db.Get(&postExists, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND status = 'ready')", postID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -413,15 +556,64 @@ func (h *PostHandler) AddComment(c *gin.Context) {
 		return
 	}
 
+	// Replies must be to a comment on the same post. Replies to the deepest
+	// level join the thread of the comment being replied to.
+	var parent *models.Comment
+	var parentID *string
+	depth := 0
+	if req.ParentCommentID != "" {
+		parent = &models.Comment{}
+		err := h.db.Get(parent, "SELECT * FROM comments WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL", req.ParentCommentID, postID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if parent.Depth >= models.MaxCommentDepth {
+			parentID, depth = parent.ParentCommentID, parent.Depth
+		} else {
+			parentID, depth = &parent.ID, parent.Depth+1
+		}
+	}
+
+	// Find mentions and hashtags in the comment
+	contentEntities, err := parseEntities(h.db, req.Content)
+	if err != nil {
+		log.Printf("AddComment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Create comment
 	commentID := uuid.New().String()
 	now := time.Now()
 
-	_, err = h.db.Exec(
-		"INSERT INTO comments (id, post_id, user_id, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
-		commentID, postID, userID, req.Content, now, now,
+	tx, err := h.db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var mentioned []string
+	_, err = tx.Exec(
+		"INSERT INTO comments (id, post_id, parent_comment_id, depth, user_id, content, content_entities, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		commentID, postID, parentID, depth, userID, req.Content, contentEntities, now, now,
 	)
+	if err == nil {
+		mentioned, err = saveEntities(tx, "comment", commentID, contentEntities)
+	}
+	if err == nil {
+		err = notifyComment(tx, postID, commentID, userID.(string), parent, mentioned)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		log.Printf("AddComment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
 		return
 	}
@@ -435,14 +627,18 @@ func (h *PostHandler) AddComment(c *gin.Context) {
 	}
 
 	// Create comment response
+	commenterID := userID.(string)
 	comment := models.Comment{
-		ID:        commentID,
-		PostID:    postID,
-		UserID:    userID.(string),
-		Username:  username,
-		Content:   req.Content,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:              commentID,
+		PostID:          postID,
+		ParentCommentID: parentID,
+		Depth:           depth,
+		UserID:          &commenterID,
+		Username:        username,
+		Content:         req.Content,
+		Entities:        contentEntities,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
 
 	// Return success
@@ -462,7 +658,7 @@ func (h *PostHandler) DeleteComment(c *gin.Context) {
 
 	// Check if comment exists and belongs to user
 	var commentExists bool
-	err := h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND user_id = $2)", commentID, userID)
+	err := h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)", commentID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -472,13 +668,25 @@ func (h *PostHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	// Delete comment
-	_, err = h.db.Exec("DELETE FROM comments WHERE id = $1", commentID)
+	// Delete comment, keeping a tombstone if it has replies
+	tx, err := h.db.Beginx()
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := deleteComment(tx, commentID); err != nil {
+		log.Printf("DeleteComment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
@@ -506,7 +714,7 @@ func (h *PostHandler) UpdateComment(c *gin.Context) {
 
 	// Check if comment exists and belongs to user
 	var commentExists bool
-	err := h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND user_id = $2)", commentID, userID)
+	err := h.db.Get(&commentExists, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)", commentID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -516,13 +724,41 @@ func (h *PostHandler) UpdateComment(c *gin.Context) {
 		return
 	}
 
+	// Find mentions and hashtags in the new content
+	contentEntities, err := parseEntities(h.db, req.Content)
+	if err != nil {
+		log.Printf("UpdateComment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Update comment
+	tx, err := h.db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	_, err = h.db.Exec(
-		"UPDATE comments SET content = $1, updated_at = $2 WHERE id = $3",
-		req.Content, now, commentID,
+	var postID string
+	var mentioned []string
+	err = tx.Get(
+		&postID,
+		"UPDATE comments SET content = $1, content_entities = $2, updated_at = $3 WHERE id = $4 RETURNING post_id",
+		req.Content, contentEntities, now, commentID,
 	)
+	if err == nil {
+		mentioned, err = saveEntities(tx, "comment", commentID, contentEntities)
+	}
+	if err == nil {
+		err = notifyMentions(tx, userID.(string), postID, commentID, mentioned)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		log.Printf("UpdateComment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
@@ -531,10 +767,10 @@ func (h *PostHandler) UpdateComment(c *gin.Context) {
 	var comment models.Comment
 	err = h.db.Get(
 		&comment,
-		`SELECT c.*, u.username 
+		fmt.Sprintf(`SELECT c.*, u.username, %s
 		FROM comments c 
 		JOIN users u ON c.user_id = u.id 
-		WHERE c.id = $1`,
+		WHERE c.id = $1`, replyCountColumn),
 		commentID,
 	)
 	if err != nil {
@@ -578,13 +814,42 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
+	// Find mentions and hashtags in the new caption
+	captionEntities, err := parseEntities(h.db, req.Caption)
+	if err != nil {
+		log.Printf("UpdatePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Update post
+	tx, err := h.db.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	_, err = h.db.Exec(
-		"UPDATE posts SET caption = $1, updated_at = $2 WHERE id = $3",
-		req.Caption, now, postID,
+	var status string
+	var mentioned []string
+	err = tx.Get(
+		&status,
+		"UPDATE posts SET caption = $1, caption_entities = $2, updated_at = $3 WHERE id = $4 RETURNING status",
+		req.Caption, captionEntities, now, postID,
 	)
+	if err == nil {
+		mentioned, err = saveEntities(tx, "post", postID, captionEntities)
+	}
+	if err == nil && status == models.PostStatusReady {
+		// Posts still processing tell everyone mentioned once they're ready
+		err = notifyMentions(tx, userID.(string), postID, "", mentioned)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		log.Printf("UpdatePost: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
 		return
 	}
@@ -604,22 +869,22 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
+	// Get media items
+	if err := loadPostMedia(h.db, &post); err != nil {
+		log.Printf("UpdatePost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post media"})
+		return
+	}
+
 	// Get comments for the post
-	err = h.db.Select(
-		&post.Comments,
-		`SELECT c.*, u.username 
-		FROM comments c 
-		JOIN users u ON c.user_id = u.id 
-		WHERE c.post_id = $1  
-		ORDER BY c.created_at ASC`,
-		postID,
-	)
-	if err != nil {
+	if err := loadComments(h.db, &post, userID.(string), commentOrders["oldest"]); err != nil {
+		log.Printf("UpdatePost: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
 		return
 	}
 
 	// Return updated post with comments
+	renderPost(h.urls.Batch(c.Request.Context()), &post)
 	c.JSON(http.StatusOK, post)
 }
 
@@ -637,7 +902,7 @@ func (h *PostHandler) LikePost(c *gin.Context) {
 
 	// Check if post exists
 	var postExists bool
-	err := h.db.Get(&postExists, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1)", postID)
+	err := h.db.Get(&postExists, "SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND status = 'ready')", postID)
 	if err != nil {
 		log.Printf("LikePost: Database error checking if post exists: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -684,12 +949,26 @@ func (h *PostHandler) LikePost(c *gin.Context) {
 		}
 
 		// Increment post likes count
-		_, err = tx.Exec("UPDATE posts SET likes = likes + 1 WHERE id = $1", postID)
+		var ownerID string
+		err = tx.Get(&ownerID, "UPDATE posts SET likes = likes + 1 WHERE id = $1 RETURNING user_id", postID)
 		if err != nil {
 			log.Printf("LikePost: Failed to update post like count: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update like count"})
 			return
 		}
+
+		// Tell the post's owner
+		err = notifications.Notify(tx, notifications.Event{
+			Type:    models.NotificationLike,
+			UserID:  ownerID,
+			ActorID: userID.(string),
+			PostID:  postID,
+		})
+		if err != nil {
+			log.Printf("LikePost: Failed to notify post owner: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
+			return
+		}
 	}
 
 	// Commit transaction
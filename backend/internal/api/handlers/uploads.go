@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backend/internal/services/media"
+	"backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// How long a presigned upload URL stays valid
+const uploadURLExpiry = 15 * time.Minute
+
+// Room for multipart boundaries, headers and the caption on top of the files
+// in a CreatePost request
+const multipartOverhead = 1 << 20
+
+// stagingPrefix is where a user's direct uploads are placed. Posts may only be
+// created from keys under the creating user's own prefix.
+func stagingPrefix(userID string) string {
+	return storage.StagingPrefix + userID + "/"
+}
+
+// newStagingKey returns a fresh key under the user's staging prefix. Only the
+// extension is kept from the client's file name, and only if it is one we
+// recognise, so that every key has the shape checked by validStagingKey.
+func newStagingKey(userID string, fileName string) string {
+	return stagingPrefix(userID) + uuid.New().String() + stagingExtension(fileName)
+}
+
+// stagingExtension returns the lower-cased extension of fileName if it names a
+// media type we accept, and "" otherwise
+func stagingExtension(fileName string) string {
+	if media.ContentTypeFromExtension(fileName) == "" {
+		return ""
+	}
+	return strings.ToLower(filepath.Ext(fileName))
+}
+
+// validStagingKey reports whether key is one newStagingKey could have issued
+// to the user: their staging prefix, a UUID and an optional known extension,
+// with nothing else that could point the key at another object
+func validStagingKey(userID string, key string) bool {
+	name, ok := strings.CutPrefix(key, stagingPrefix(userID))
+	if !ok {
+		return false
+	}
+	id, ext, found := strings.Cut(name, ".")
+	if found {
+		ext = "." + ext
+	}
+	parsed, err := uuid.Parse(id)
+	return err == nil && parsed.String() == id && ext == stagingExtension(ext)
+}
+
+// CreateUpload issues a presigned URL the client can PUT a media file to. The
+// returned uploadKey is then passed to CreatePost in place of a file.
+func (h *PostHandler) CreateUpload(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	// Parse request
+	var req struct {
+		FileName    string `json:"fileName" binding:"required"`
+		ContentType string `json:"contentType" binding:"required"`
+		Size        int64  `json:"size" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// The uploaded content is validated again by the worker, since the client
+	// can PUT something other than what it declared here
+	if err := h.validator.CheckDeclared(req.ContentType, req.Size); err != nil {
+		c.JSON(validationStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	key := newStagingKey(userID.(string), req.FileName)
+	uploadURL, err := h.blob.PresignedUploadURL(c.Request.Context(), key, req.ContentType, req.Size, uploadURLExpiry)
+	if err != nil {
+		if errors.Is(err, storage.ErrPresignedUploads) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "Direct uploads are not available, upload the file with the post instead"})
+			return
+		}
+		log.Printf("CreateUpload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload URL"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"uploadUrl": uploadURL,
+		"uploadKey": key,
+		"method":    http.MethodPut,
+		"headers":   gin.H{"Content-Type": req.ContentType},
+		"expiresAt": time.Now().Add(uploadURLExpiry),
+	})
+}
+
+// validationStatus returns the HTTP status for a rejected upload
+func validationStatus(err error) int {
+	switch {
+	case errors.Is(err, media.ErrMediaTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, media.ErrUnsupportedMedia):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, media.ErrDuplicateMedia):
+		return http.StatusConflict
+	case errors.Is(err, media.ErrBlockedMedia):
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
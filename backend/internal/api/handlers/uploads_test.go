@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testUserID  = "8f14e45f-ceea-467f-a0e6-7a9b3c2d1e00"
+	otherUserID = "c9f0f895-fb98-4b91-9d3e-5a2a1c6b7d11"
+	testFileID  = "45c48cce-2e2d-4fbd-8a1c-1b2c3d4e5f60"
+)
+
+func TestStagingExtension(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     string
+	}{
+		{"photo.jpg", ".jpg"},
+		{"Photo.JPEG", ".jpeg"},
+		{"clip.MOV", ".mov"},
+		{"archive.tar.mp4", ".mp4"},
+		{"notes.txt", ""},
+		{"noextension", ""},
+		{"", ""},
+		{"../../etc/passwd", ""},
+		{"evil.jpg/..", ""},
+	}
+
+	for _, tt := range tests {
+		if got := stagingExtension(tt.fileName); got != tt.want {
+			t.Errorf("stagingExtension(%q) = %q, want %q", tt.fileName, got, tt.want)
+		}
+	}
+}
+
+func TestNewStagingKey(t *testing.T) {
+	for _, fileName := range []string{"photo.JPG", "clip.mp4", "notes.txt", "../../x.png", ""} {
+		key := newStagingKey(testUserID, fileName)
+		if !validStagingKey(testUserID, key) {
+			t.Errorf("newStagingKey(%q) = %q, which validStagingKey rejects", fileName, key)
+		}
+		if validStagingKey(otherUserID, key) {
+			t.Errorf("newStagingKey(%q) = %q, which validStagingKey accepts for another user", fileName, key)
+		}
+	}
+}
+
+func TestValidStagingKey(t *testing.T) {
+	prefix := stagingPrefix(testUserID)
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"without extension", prefix + testFileID, true},
+		{"with extension", prefix + testFileID + ".jpg", true},
+		{"video extension", prefix + testFileID + ".webm", true},
+		{"another user's prefix", stagingPrefix(otherUserID) + testFileID + ".jpg", false},
+		{"outside staging", "posts/" + testFileID + ".jpg", false},
+		{"empty", "", false},
+		{"prefix only", prefix, false},
+		{"not a uuid", prefix + "photo.jpg", false},
+		{"upper-case uuid", prefix + strings.ToUpper(testFileID) + ".jpg", false},
+		{"braced uuid", prefix + "{" + testFileID + "}.jpg", false},
+		{"uuid without dashes", prefix + strings.ReplaceAll(testFileID, "-", "") + ".jpg", false},
+		{"upper-case extension", prefix + testFileID + ".JPG", false},
+		{"unknown extension", prefix + testFileID + ".txt", false},
+		{"double extension", prefix + testFileID + ".jpg.png", false},
+		{"trailing dot", prefix + testFileID + ".", false},
+		{"parent directory", prefix + "../" + otherUserID + "/" + testFileID + ".jpg", false},
+		{"traversal after uuid", prefix + testFileID + "/../../posts/x.jpg", false},
+		{"nested path", prefix + testFileID + "/" + testFileID + ".jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validStagingKey(testUserID, tt.key); got != tt.want {
+				t.Errorf("validStagingKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,26 +1,48 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"backend/internal/models"
 	"backend/internal/services/auth"
+	"backend/internal/services/compression"
+	"backend/internal/services/media"
+	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+// avatarsPrefix is where profile pictures are stored, each upload's sizes
+// under a prefix of their own
+const avatarsPrefix = "avatars/"
+
 // UserHandler handles user-related requests
 type UserHandler struct {
-	db *sqlx.DB
+	db        *sqlx.DB
+	blob      storage.Blob
+	urls      *storage.URLSigner
+	validator *media.Validator
 }
 
-// NewUserHandler creates a new user handler
-func NewUserHandler(db *sqlx.DB) *UserHandler {
+// NewUserHandler creates a new user handler. Profile pictures are checked by
+// validator against the image upload limits.
+func NewUserHandler(db *sqlx.DB, blob storage.Blob, urls *storage.URLSigner, validator *media.Validator) *UserHandler {
 	return &UserHandler{
-		db: db,
+		db:        db,
+		blob:      blob,
+		urls:      urls,
+		validator: validator,
 	}
 }
 
@@ -53,8 +75,8 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	}
 
 	profilePicture := ""
-	if user.ProfilePicture.Valid {
-		profilePicture = user.ProfilePicture.String
+	if user.ProfilePictureKey.Valid {
+		profilePicture = h.urls.Batch(c.Request.Context()).URL(user.ProfilePictureKey.String)
 	}
 
 	// Create user response
@@ -142,8 +164,8 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	}
 
 	profilePicture := ""
-	if user.ProfilePicture.Valid {
-		profilePicture = user.ProfilePicture.String
+	if user.ProfilePictureKey.Valid {
+		profilePicture = h.urls.Batch(c.Request.Context()).URL(user.ProfilePictureKey.String)
 	}
 
 	// Create user response
@@ -164,6 +186,128 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	})
 }
 
+// UploadAvatar replaces the current user's profile picture
+func (h *UserHandler) UploadAvatar(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	// Limit the request size before the form is parsed
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.validator.MaxImageBytes()+multipartOverhead)
+
+	file, err := c.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload is too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	if file.Size > h.validator.MaxImageBytes() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Image is too large, the limit is %d MB", h.validator.MaxImageBytes()>>20)})
+		return
+	}
+
+	// Read file into memory
+	fileData, err := readFormFile(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	// Check the format and resolution before decoding anything
+	if _, err := h.validator.ValidateImage(fileData); err != nil {
+		c.JSON(validationStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Crop and resize into every avatar size. The format is detected from the
+	// content, whatever the client declared.
+	renditions, err := compression.CreateAvatar(c.Request.Context(), fileData)
+	if err != nil {
+		var unavailable *compression.DecoderUnavailableError
+		var decodeErr *compression.DecodeError
+		switch {
+		case errors.Is(err, compression.ErrUnsupportedFormat):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported image type, please upload a JPEG, PNG, WebP or HEIC image"})
+		case errors.As(err, &unavailable):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": strings.ToUpper(unavailable.Format) + " images are not supported on this server, please upload a JPEG, PNG or WebP"})
+		case errors.As(err, &decodeErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The image could not be read, it may be damaged"})
+		default:
+			log.Printf("UploadAvatar: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		}
+		return
+	}
+
+	// Upload every size under a shared prefix so they can be replaced together
+	prefix := avatarsPrefix + uuid.New().String()
+	urls := h.urls.Batch(c.Request.Context())
+	sizes := make(map[string]string, len(renditions))
+	for _, size := range compression.AvatarSizes {
+		key := fmt.Sprintf("%s/%d.jpg", prefix, size)
+		if _, err := h.blob.Upload(c.Request.Context(), key, renditions[size], "image/jpeg"); err != nil {
+			deleteAvatarPrefix(c.Request.Context(), h.blob, prefix)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload avatar"})
+			return
+		}
+		sizes[strconv.Itoa(size)] = urls.URL(key)
+	}
+
+	// The default size is what the rest of the API returns as profilePicture.
+	// The previous key is read in the same statement, with the row locked, so
+	// concurrent uploads each get back the avatar they replaced.
+	profilePictureKey := fmt.Sprintf("%s/%d.jpg", prefix, compression.DefaultAvatarSize)
+	var previous sql.NullString
+	err = h.db.Get(
+		&previous,
+		`UPDATE users u SET profile_picture_key = $1, updated_at = $2
+		FROM (SELECT id, profile_picture_key FROM users WHERE id = $3 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.profile_picture_key`,
+		profilePictureKey, time.Now(), userID,
+	)
+	if err != nil {
+		deleteAvatarPrefix(c.Request.Context(), h.blob, prefix)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile picture"})
+		return
+	}
+
+	// Delete the previous avatar after the database points at the new one
+	if previous.Valid {
+		deleteAvatar(c.Request.Context(), h.blob, previous.String)
+	}
+
+	// Return success
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Profile picture updated successfully",
+		"profilePicture": urls.URL(profilePictureKey),
+		"sizes":          sizes,
+	})
+}
+
+// deleteAvatar removes every size of the avatar whose default size is stored
+// at key. Profile pictures from before avatars were resized aren't under
+// avatarsPrefix and are left alone.
+func deleteAvatar(ctx context.Context, blob storage.Blob, key string) {
+	if strings.HasPrefix(key, avatarsPrefix) {
+		deleteAvatarPrefix(ctx, blob, path.Dir(key))
+	}
+}
+
+// deleteAvatarPrefix removes every size of an avatar stored under prefix
+func deleteAvatarPrefix(ctx context.Context, blob storage.Blob, prefix string) {
+	if err := blob.DeletePrefix(ctx, prefix+"/"); err != nil {
+		log.Printf("Warning: Failed to delete avatar from storage: %v, prefix: %s", err, prefix)
+	}
+}
+
 // UpdatePassword updates the current user's password
 func (h *UserHandler) UpdatePassword(c *gin.Context) {
 	// Get user ID from context
@@ -243,24 +387,31 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	// Delete user's comments
-	_, err = tx.Exec("DELETE FROM comments WHERE user_id = $1", userID)
-	if err != nil {
+	// Delete user's comments, keeping those with replies as tombstones
+	if err := deleteUserComments(tx, userID.(string)); err != nil {
+		log.Printf("DeleteUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comments"})
 		return
 	}
 
-	// Get user's posts
-	var postIDs []string
-	err = tx.Select(&postIDs, "SELECT id FROM posts WHERE user_id = $1", userID)
+	// Note the avatar, to delete after the user
+	var avatarKey sql.NullString
+	if err := tx.Get(&avatarKey, "SELECT profile_picture_key FROM users WHERE id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	// Get user's posts, noting their files to delete afterwards
+	posts, err := getUserPostMedia(tx, userID.(string))
 	if err != nil {
+		log.Printf("DeleteUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
 	// Delete comments on user's posts
-	for _, postID := range postIDs {
-		_, err = tx.Exec("DELETE FROM comments WHERE post_id = $1", postID)
+	for _, post := range posts {
+		_, err = tx.Exec("DELETE FROM comments WHERE post_id = $1", post.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post comments"})
 			return
@@ -287,49 +438,71 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Delete media from S3 after the database transaction is complete
+	for _, post := range posts {
+		deletePostMedia(c.Request.Context(), h.blob, post)
+	}
+	if avatarKey.Valid {
+		deleteAvatar(c.Request.Context(), h.blob, avatarKey.String)
+	}
+
 	// Return success
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
-// GetUserPosts returns posts by a specific user
+// GetUserPosts returns a page of posts by a specific user, newest first
 func (h *UserHandler) GetUserPosts(c *gin.Context) {
 	userID := c.Param("id")
 
-	// Get posts
-	var posts []models.Post
-	err := h.db.Select(
+	limit, cursor, err := parsePageParams(c, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters: " + err.Error()})
+		return
+	}
+
+	// Owners see every one of their posts, whatever its status
+	visible := "p.status = 'ready'"
+	if viewerID(c) == userID {
+		visible = "TRUE"
+	}
+
+	// Get posts, fetching one extra to know whether another page exists
+	condition, args := cursorCondition(cursor, "p.created_at", "p.id", []interface{}{userID})
+	args = append(args, limit+1)
+
+	posts := []models.Post{}
+	err = h.db.Select(
 		&posts,
-		`SELECT p.*, u.username 
+		fmt.Sprintf(`SELECT p.*, u.username 
 		FROM posts p 
 		JOIN users u ON p.user_id = u.id 
-		WHERE p.user_id = $1 
-		ORDER BY p.created_at DESC`,
-		userID,
+		WHERE p.user_id = $1 AND %s AND %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $%d`, visible, condition, len(args)),
+		args...,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posts"})
 		return
 	}
 
-	// Get comments for each post
-	for i := range posts {
-		err := h.db.Select(
-			&posts[i].Comments,
-			`SELECT c.*, u.username 
-			FROM comments c 
-			JOIN users u ON c.user_id = u.id 
-			WHERE c.post_id = $1 
-			ORDER BY c.created_at ASC`,
-			posts[i].ID,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
-			return
-		}
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	// Load like status and comment previews for the whole page
+	if err := assembleFeed(h.db, posts, viewerID(c)); err != nil {
+		log.Printf("GetUserPosts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comments"})
+		return
 	}
 
 	// Return posts
-	c.JSON(http.StatusOK, posts)
+	renderPosts(h.urls.Batch(c.Request.Context()), posts)
+	c.JSON(http.StatusOK, models.Page{Items: posts, NextCursor: nextCursor})
 }
 
 func (h *UserHandler) GetUserProfile(c *gin.Context) {
@@ -360,8 +533,8 @@ func (h *UserHandler) GetUserProfile(c *gin.Context) {
 	}
 
 	profilePicture := ""
-	if user.ProfilePicture.Valid {
-		profilePicture = user.ProfilePicture.String
+	if user.ProfilePictureKey.Valid {
+		profilePicture = h.urls.Batch(c.Request.Context()).URL(user.ProfilePictureKey.String)
 	}
 
 	// Get follower counts
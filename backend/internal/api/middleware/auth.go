@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -21,38 +22,36 @@ func AuthMiddleware(jwtService *auth.JWTService, db *sqlx.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Check if the header has the "Bearer " prefix
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+		claims, err := authenticate(authHeader, jwtService, db)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// Set user ID and session ID in context
+		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
 
-		// Validate token
-		claims, err := jwtService.ValidateToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
-		}
+		c.Next()
+	}
+}
 
-		// Check if the session is still valid
-		var isValid bool
-		err = db.Get(&isValid, "SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND expires_at > NOW())", claims.SessionID, claims.UserID)
-		if err != nil || !isValid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
-			c.Abort()
+// OptionalAuthMiddleware identifies the user on public routes. Requests with a
+// valid Bearer token and session get userID and sessionID set in the context;
+// requests without one (or with an invalid one) continue anonymously.
+func OptionalAuthMiddleware(jwtService *auth.JWTService, db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Next()
 			return
 		}
 
-		// Update session last active time
-		_, err = db.Exec("UPDATE sessions SET last_active = NOW() WHERE id = $1", claims.SessionID)
+		claims, err := authenticate(authHeader, jwtService, db)
 		if err != nil {
-			// Log error but continue
-			// logger.Error("Failed to update session last active time", "error", err)
+			c.Next()
+			return
 		}
 
 		// Set user ID and session ID in context
@@ -62,3 +61,37 @@ func AuthMiddleware(jwtService *auth.JWTService, db *sqlx.DB) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// authenticate validates a Bearer authorization header and its session.
+// The returned error message is suitable for sending to the client.
+func authenticate(authHeader string, jwtService *auth.JWTService, db *sqlx.DB) (*auth.Claims, error) {
+	// Check if the header has the "Bearer " prefix
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errors.New("Invalid authorization format")
+	}
+
+	// Extract the token
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Validate token
+	claims, err := jwtService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, errors.New("Invalid or expired token")
+	}
+
+	// Check if the session is still valid
+	var isValid bool
+	err = db.Get(&isValid, "SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND expires_at > NOW())", claims.SessionID, claims.UserID)
+	if err != nil || !isValid {
+		return nil, errors.New("Session expired or revoked")
+	}
+
+	// Update session last active time
+	_, err = db.Exec("UPDATE sessions SET last_active = NOW() WHERE id = $1", claims.SessionID)
+	if err != nil {
+		// Log error but continue
+		// logger.Error("Failed to update session last active time", "error", err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadTimeout gives a route up to timeout to read its request body and write
+// its response. The server's own timeouts are sized for ordinary API requests
+// and would cut large multipart uploads off part-way through. It must run
+// before anything reads the body.
+func UploadTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := time.Now().Add(timeout)
+		controller := http.NewResponseController(c.Writer)
+		if err := controller.SetReadDeadline(deadline); err != nil {
+			log.Printf("UploadTimeout: failed to extend read deadline: %v", err)
+		}
+		if err := controller.SetWriteDeadline(deadline); err != nil {
+			log.Printf("UploadTimeout: failed to extend write deadline: %v", err)
+		}
+		c.Next()
+	}
+}
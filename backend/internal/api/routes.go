@@ -1,28 +1,41 @@
 package api
 
 import (
+	"time"
+
 	"backend/configs"
 	"backend/internal/api/handlers"
 	"backend/internal/api/middleware"
 	"backend/internal/services/admin"
 	"backend/internal/services/auth"
+	"backend/internal/services/compression"
+	"backend/internal/services/media"
 	"backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
+// Longest a multipart upload may take, where the server otherwise allows 15
+// seconds per request. Clients should prefer direct uploads for large files.
+const uploadTimeout = 30 * time.Minute
+
 // SetupRouter configures the API routes
-func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config, adminService *admin.AdminService) *gin.Engine {
+func SetupRouter(db *sqlx.DB, blob storage.Blob, config *configs.Config, adminService *admin.AdminService) *gin.Engine {
 	// Create JWT service
 	jwtService := auth.NewJWTService(config.JWT)
 
+	// Media URLs are public or presigned depending on the storage config
+	urls := storage.NewURLSigner(blob, config.Storage)
+
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(db, jwtService)
-	userHandler := handlers.NewUserHandler(db)
-	postHandler := handlers.NewPostHandler(db, s3Client)
-	adminHandler := handlers.NewAdminHandler(db, adminService)
-	followerHandler := handlers.NewFollowerHandler(db)
+	authHandler := handlers.NewAuthHandler(db, jwtService, urls)
+	validator := media.NewValidator(config.Media)
+	userHandler := handlers.NewUserHandler(db, blob, urls, validator)
+	postHandler := handlers.NewPostHandler(db, blob, urls, validator)
+	adminHandler := handlers.NewAdminHandler(db, adminService, blob)
+	followerHandler := handlers.NewFollowerHandler(db, urls)
+	notificationHandler := handlers.NewNotificationHandler(db, urls)
 
 	// Create router
 	router := gin.Default()
@@ -31,13 +44,19 @@ func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config
 	router.Use(middleware.CorsMiddleware(config.Server))
 	router.Use(middleware.RateLimitMiddleware())
 
+	// Serve uploaded media ourselves when it is stored on the local filesystem
+	if config.Storage.Driver == configs.StorageDriverLocal {
+		router.Static(storage.LocalMediaRoute, config.Storage.LocalDir)
+	}
+
 	// API routes
 	api := router.Group("/api")
 	{
-		// Health check
+		// Health check, including which image decoders were found at startup
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{
-				"status": "ok",
+				"status":   "ok",
+				"decoders": compression.DecoderStatuses(),
 			})
 		})
 
@@ -59,21 +78,27 @@ func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config
 			users.GET("/me", middleware.AuthMiddleware(jwtService, db), userHandler.GetCurrentUser)
 			users.PUT("/me", middleware.AuthMiddleware(jwtService, db), userHandler.UpdateUser)
 			users.PUT("/me/password", middleware.AuthMiddleware(jwtService, db), userHandler.UpdatePassword)
+			users.PUT("/me/avatar", middleware.UploadTimeout(uploadTimeout), middleware.AuthMiddleware(jwtService, db), userHandler.UploadAvatar)
 			users.DELETE("/me", middleware.AuthMiddleware(jwtService, db), userHandler.DeleteUser)
-			users.GET("/:id/posts", userHandler.GetUserPosts)
+			users.GET("/:id/posts", middleware.OptionalAuthMiddleware(jwtService, db), userHandler.GetUserPosts)
 		}
 
 		// Post routes
 		posts := api.Group("/posts")
 		{
-			posts.GET("", postHandler.GetPosts)
-			posts.GET("/:id", postHandler.GetPost)
-			posts.POST("", middleware.AuthMiddleware(jwtService, db), postHandler.CreatePost)
+			posts.GET("", middleware.OptionalAuthMiddleware(jwtService, db), postHandler.GetPosts)
+			posts.GET("/:id", middleware.OptionalAuthMiddleware(jwtService, db), postHandler.GetPost)
+			posts.POST("", middleware.UploadTimeout(uploadTimeout), middleware.AuthMiddleware(jwtService, db), postHandler.CreatePost)
+			posts.GET("/:id/status", middleware.AuthMiddleware(jwtService, db), postHandler.GetPostStatus)
 			posts.DELETE("/:id", middleware.AuthMiddleware(jwtService, db), postHandler.DeletePost)
 			posts.PUT("/:id", middleware.AuthMiddleware(jwtService, db), postHandler.UpdatePost)
 			posts.POST("/:id/comments", middleware.AuthMiddleware(jwtService, db), postHandler.AddComment)
 			posts.DELETE("/comments/:id", middleware.AuthMiddleware(jwtService, db), postHandler.DeleteComment)
 			posts.PUT("/comments/:id", middleware.AuthMiddleware(jwtService, db), postHandler.UpdateComment)
+			posts.GET("/comments/:id/replies", middleware.OptionalAuthMiddleware(jwtService, db), postHandler.GetReplies)
+			posts.POST("/comments/:id/like", middleware.AuthMiddleware(jwtService, db), postHandler.LikeComment)
+			posts.DELETE("/comments/:id/like", middleware.AuthMiddleware(jwtService, db), postHandler.UnlikeComment)
+			posts.GET("/comments/:id/like", middleware.AuthMiddleware(jwtService, db), postHandler.GetCommentLikeStatus)
 
 			// Add these new routes for likes
 			posts.POST("/:id/like", middleware.AuthMiddleware(jwtService, db), postHandler.LikePost)
@@ -81,6 +106,22 @@ func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config
 			posts.GET("/:id/like", middleware.AuthMiddleware(jwtService, db), postHandler.GetLikeStatus)
 		}
 
+		// Posts tagged with a hashtag
+		api.GET("/hashtags/:tag", middleware.OptionalAuthMiddleware(jwtService, db), postHandler.GetHashtagPosts)
+
+		// Notifications of follows, likes, comments and mentions
+		notificationRoutes := api.Group("/notifications")
+		notificationRoutes.Use(middleware.AuthMiddleware(jwtService, db))
+		{
+			notificationRoutes.GET("", notificationHandler.GetNotifications)
+			notificationRoutes.GET("/unread-count", notificationHandler.GetUnreadCount)
+			notificationRoutes.POST("/:id/read", notificationHandler.MarkRead)
+			notificationRoutes.POST("/read-all", notificationHandler.MarkAllRead)
+		}
+
+		// Direct-to-storage uploads, finalized by creating a post
+		api.POST("/uploads", middleware.AuthMiddleware(jwtService, db), postHandler.CreateUpload)
+
 		// Admin routes
 		adminRoutes := api.Group("/admin")
 		adminRoutes.Use(middleware.AuthMiddleware(jwtService, db))
@@ -97,12 +138,18 @@ func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config
 
 			// Content moderation
 			adminRoutes.DELETE("/posts/:id", adminHandler.DeletePost)
+			adminRoutes.PUT("/posts/:id/remove", adminHandler.RemovePost)
 			adminRoutes.DELETE("/comments/:id", adminHandler.DeleteComment)
 			adminRoutes.GET("/comments", adminHandler.GetAllComments)
+
+			// Blocklist of media taken down, matched by perceptual hash
+			adminRoutes.GET("/blocked-hashes", adminHandler.GetBlockedHashes)
+			adminRoutes.POST("/blocked-hashes", adminHandler.BlockHashes)
+			adminRoutes.DELETE("/blocked-hashes/:id", adminHandler.UnblockHash)
 		}
 
 		// User profile with follower counts
-		users.GET("/:id/profile", userHandler.GetUserProfile)
+		users.GET("/:id/profile", middleware.OptionalAuthMiddleware(jwtService, db), userHandler.GetUserProfile)
 
 		follow := api.Group("/follow")
 		{
@@ -112,15 +159,15 @@ func SetupRouter(db *sqlx.DB, s3Client *storage.S3Client, config *configs.Config
 			follow.GET("/:id/status", middleware.AuthMiddleware(jwtService, db), followerHandler.GetFollowStatus)
 
 			// Public routes (no authentication required, but enhanced if authenticated)
-			follow.GET("/:id/followers", followerHandler.GetFollowers)
-			follow.GET("/:id/following", followerHandler.GetFollowing)
+			follow.GET("/:id/followers", middleware.OptionalAuthMiddleware(jwtService, db), followerHandler.GetFollowers)
+			follow.GET("/:id/following", middleware.OptionalAuthMiddleware(jwtService, db), followerHandler.GetFollowing)
 
 			// Following feed (requires authentication)
 			follow.GET("/feed", middleware.AuthMiddleware(jwtService, db), followerHandler.GetFollowingPostsFeed)
 		}
 
 		// User search route (public but enhanced if authenticated)
-		api.GET("/users/search", followerHandler.SearchUsers)
+		api.GET("/users/search", middleware.OptionalAuthMiddleware(jwtService, db), followerHandler.SearchUsers)
 
 	}
 
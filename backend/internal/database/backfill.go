@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"backend/internal/storage"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// mediaKeyColumns lists every column that holds a storage object key
+var mediaKeyColumns = []struct {
+	Table  string
+	Column string
+}{
+	{"posts", "media_key"},
+	{"posts", "thumbnail_key"},
+	{"post_media", "media_key"},
+	{"post_media", "thumbnail_key"},
+	{"users", "profile_picture_key"},
+}
+
+// BackfillMediaKeys converts media columns that still hold full URLs, written
+// before keys were stored, into object keys. Rows that already hold keys are
+// left alone, so it is safe to run on every startup. Rows are matched by the
+// URL itself, since not every table has an id column and rows sharing a URL
+// (such as a post and its copied cover item) share its key too.
+func BackfillMediaKeys(db *sqlx.DB, blob storage.Blob) error {
+	for _, target := range mediaKeyColumns {
+		var refs []string
+		query := fmt.Sprintf(
+			"SELECT DISTINCT %s FROM %s WHERE %s LIKE 'http://%%' OR %s LIKE 'https://%%'",
+			target.Column, target.Table, target.Column, target.Column,
+		)
+		if err := db.Select(&refs, query); err != nil {
+			return fmt.Errorf("failed to find %s.%s URLs: %w", target.Table, target.Column, err)
+		}
+
+		update := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2", target.Table, target.Column, target.Column)
+		for _, ref := range refs {
+			key, err := blob.ObjectKey(ref)
+			if err != nil {
+				log.Printf("Warning: Failed to resolve object key for %s.%s %s: %v", target.Table, target.Column, ref, err)
+				continue
+			}
+			if _, err := db.Exec(update, key, ref); err != nil {
+				return fmt.Errorf("failed to update %s.%s: %w", target.Table, target.Column, err)
+			}
+		}
+
+		if len(refs) > 0 {
+			log.Printf("Backfilled %d object keys in %s.%s", len(refs), target.Table, target.Column)
+		}
+	}
+
+	return nil
+}
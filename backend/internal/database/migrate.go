@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/migrations"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Key for the Postgres advisory lock held while migrating, so that several
+// server replicas starting at once don't apply the same migration twice
+const migrationLockKey = 3610001
+
+// Migration filenames look like 0002_add_thumbnails.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// LoadMigrations reads and orders the migrations in fsys
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// Migrate applies every pending migration in order
+func Migrate(db *sqlx.DB) error {
+	return withMigrationLock(db, func(conn *sqlx.Conn, all []Migration, applied map[int]appliedMigration) error {
+		pending := 0
+		for _, m := range all {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			log.Printf("Applying migration %04d_%s...", m.Version, m.Name)
+			err := runInTx(conn, m.Up,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+				m.Version, m.Name, m.Checksum, time.Now(),
+			)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+			pending++
+		}
+
+		if pending == 0 {
+			log.Println("Database schema is up to date")
+		} else {
+			log.Printf("Applied %d migration(s)", pending)
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first
+func MigrateDown(db *sqlx.DB, steps int) error {
+	return withMigrationLock(db, func(conn *sqlx.Conn, all []Migration, applied map[int]appliedMigration) error {
+		for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+			m := all[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+			}
+
+			log.Printf("Reverting migration %04d_%s...", m.Version, m.Name)
+			err := runInTx(conn, m.Down, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus lists every known migration and when it was applied
+func GetMigrationStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrationLock(db, func(conn *sqlx.Conn, all []Migration, applied map[int]appliedMigration) error {
+		for _, m := range all {
+			status := MigrationStatus{Version: m.Version, Name: m.Name}
+			if row, ok := applied[m.Version]; ok {
+				appliedAt := row.AppliedAt
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withMigrationLock takes the migration advisory lock on a dedicated
+// connection, verifies applied migrations against their files and runs fn
+func withMigrationLock(db *sqlx.DB, fn func(conn *sqlx.Conn, all []Migration, applied map[int]appliedMigration) error) error {
+	ctx := context.Background()
+
+	all, err := LoadMigrations(migrations.Files)
+	if err != nil {
+		return err
+	}
+
+	// Advisory locks belong to a session, so lock and unlock on the same connection
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			log.Printf("Warning: Failed to release migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var rows []appliedMigration
+	if err := conn.SelectContext(ctx, &rows, "SELECT version, name, checksum, applied_at FROM schema_migrations"); err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	applied, err := verifyApplied(all, rows)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, all, applied)
+}
+
+// verifyApplied indexes the applied migrations by version, refusing to
+// continue if one was edited after the fact or its file is gone
+func verifyApplied(all []Migration, rows []appliedMigration) (map[int]appliedMigration, error) {
+	known := make(map[int]Migration, len(all))
+	for _, m := range all {
+		known[m.Version] = m
+	}
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		m, ok := known[row.Version]
+		if !ok {
+			return nil, fmt.Errorf("database has migration %04d_%s applied but no such file exists", row.Version, row.Name)
+		}
+		if m.Checksum != row.Checksum {
+			return nil, fmt.Errorf("migration %04d_%s has been modified since it was applied", m.Version, m.Name)
+		}
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// runInTx executes a migration script and its bookkeeping statement atomically
+func runInTx(conn *sqlx.Conn, script string, bookkeeping string, args ...interface{}) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Scripts are run without arguments so that multiple statements are allowed
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
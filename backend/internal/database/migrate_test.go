@@ -0,0 +1,183 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"backend/migrations"
+)
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"0010_later.up.sql":    {Data: []byte("SELECT 10;")},
+				"0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+				"0002_second.down.sql": {Data: []byte("SELECT -2;")},
+				"0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+			},
+			versions: []int{1, 2, 10},
+		},
+		{
+			name: "other files are ignored",
+			files: fstest.MapFS{
+				"0001_first.up.sql": {Data: []byte("SELECT 1;")},
+				"embed.go":          {Data: []byte("package migrations")},
+				"README.md":         {Data: []byte("notes")},
+				"1_Bad-Name.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			versions: []int{1},
+		},
+		{
+			name:     "empty",
+			files:    fstest.MapFS{},
+			versions: []int{},
+		},
+		{
+			name: "missing up file",
+			files: fstest.MapFS{
+				"0001_first.down.sql": {Data: []byte("SELECT -1;")},
+			},
+			err: "has no up file",
+		},
+		{
+			name: "version used twice",
+			files: fstest.MapFS{
+				"0001_first.up.sql": {Data: []byte("SELECT 1;")},
+				"0001_other.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			err: "is used by both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := LoadMigrations(tt.files)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadMigrations() error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMigrations() error = %v", err)
+			}
+			if len(list) != len(tt.versions) {
+				t.Fatalf("LoadMigrations() returned %d migrations, want %d", len(list), len(tt.versions))
+			}
+			for i, m := range list {
+				if m.Version != tt.versions[i] {
+					t.Errorf("migration %d has version %d, want %d", i, m.Version, tt.versions[i])
+				}
+				if m.Checksum != checksum(m.Up) {
+					t.Errorf("migration %d checksum = %s, want the SHA-256 of its up file", m.Version, m.Checksum)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsDown(t *testing.T) {
+	list, err := LoadMigrations(fstest.MapFS{
+		"0001_first.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql": {Data: []byte("DROP TABLE a;")},
+	})
+	if err != nil {
+		t.Fatalf("LoadMigrations() error = %v", err)
+	}
+	if list[0].Name != "first" || list[0].Up != "CREATE TABLE a ();" || list[0].Down != "DROP TABLE a;" {
+		t.Errorf("LoadMigrations() = %+v", list[0])
+	}
+}
+
+// The embedded migrations must always load, with versions in sequence
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := LoadMigrations(migrations.Files)
+	if err != nil {
+		t.Fatalf("LoadMigrations() error = %v", err)
+	}
+	for i, m := range list {
+		if m.Version != i+1 {
+			t.Errorf("migration %04d_%s is out of sequence, want version %d", m.Version, m.Name, i+1)
+		}
+	}
+}
+
+func TestVerifyApplied(t *testing.T) {
+	all := []Migration{
+		{Version: 1, Name: "first", Checksum: checksum("SELECT 1;")},
+		{Version: 2, Name: "second", Checksum: checksum("SELECT 2;")},
+	}
+
+	tests := []struct {
+		name    string
+		rows    []appliedMigration
+		applied []int
+		err     string
+	}{
+		{name: "nothing applied", applied: []int{}},
+		{
+			name: "all applied",
+			rows: []appliedMigration{
+				{Version: 1, Name: "first", Checksum: checksum("SELECT 1;")},
+				{Version: 2, Name: "second", Checksum: checksum("SELECT 2;")},
+			},
+			applied: []int{1, 2},
+		},
+		{
+			name:    "some applied",
+			rows:    []appliedMigration{{Version: 1, Name: "first", Checksum: checksum("SELECT 1;")}},
+			applied: []int{1},
+		},
+		{
+			name: "edited after being applied",
+			rows: []appliedMigration{
+				{Version: 1, Name: "first", Checksum: checksum("SELECT 1;")},
+				{Version: 2, Name: "second", Checksum: checksum("SELECT 'two';")},
+			},
+			err: "0002_second has been modified",
+		},
+		{
+			name: "file removed after being applied",
+			rows: []appliedMigration{{Version: 3, Name: "third", Checksum: checksum("SELECT 3;")}},
+			err:  "0003_third applied but no such file exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, err := verifyApplied(all, tt.rows)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("verifyApplied() error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyApplied() error = %v", err)
+			}
+			if len(applied) != len(tt.applied) {
+				t.Fatalf("verifyApplied() returned %d migrations, want %d", len(applied), len(tt.applied))
+			}
+			for _, version := range tt.applied {
+				if _, ok := applied[version]; !ok {
+					t.Errorf("verifyApplied() is missing version %d", version)
+				}
+			}
+		})
+	}
+}
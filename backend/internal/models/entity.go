@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Entity types found in captions and comments
+const (
+	EntityMention = "mention"
+	EntityHashtag = "hashtag"
+)
+
+// Entity is an @mention or #hashtag in a caption or comment. Start and End
+// are offsets into the text in UTF-16 code units, as JavaScript strings are
+// indexed; the range includes the @ or # and End is exclusive.
+type Entity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`             // Username, or lowercase tag, without the @ or #
+	UserID string `json:"userId,omitempty"` // The mentioned user
+}
+
+// Entities are stored as a JSON array alongside the text they were found in
+type Entities []Entity
+
+// Value implements driver.Valuer
+func (e Entities) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (e *Entities) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, e)
+	case string:
+		return json.Unmarshal([]byte(src), e)
+	}
+	return fmt.Errorf("cannot scan %T into Entities", src)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification types
+const (
+	NotificationFollow  = "follow"  // Someone followed the user
+	NotificationLike    = "like"    // Someone liked the user's post
+	NotificationComment = "comment" // Someone commented on the user's post
+	NotificationReply   = "reply"   // Someone replied to the user's comment
+	NotificationMention = "mention" // Someone mentioned the user in a post or comment
+)
+
+// Notification tells a user that one or more others did something involving
+// them. Notifications that group several actors are updated as more join.
+type Notification struct {
+	ID         string              `json:"id" db:"id"`
+	UserID     string              `json:"-" db:"user_id"`
+	Type       string              `json:"type" db:"type"`
+	GroupKey   *string             `json:"-" db:"group_key"`
+	PostID     *string             `json:"postId,omitempty" db:"post_id"`
+	CommentID  *string             `json:"commentId,omitempty" db:"comment_id"` // The latest comment, or for replies the comment replied to
+	Actors     []NotificationActor `json:"actors" db:"-"`                       // The most recent few, newest first
+	ActorCount int                 `json:"actorCount" db:"actor_count"`
+	Message    string              `json:"message" db:"-"` // e.g. "alice and 4 others liked your post"
+	Read       bool                `json:"read" db:"-"`
+	ReadAt     *time.Time          `json:"-" db:"read_at"`
+	CreatedAt  time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time           `json:"updatedAt" db:"updated_at"` // When the latest actor joined
+}
+
+// NotificationActor is a user who caused a notification
+type NotificationActor struct {
+	NotificationID string `json:"-" db:"notification_id"`
+	ID             string `json:"id" db:"id"`
+	Username       string `json:"username" db:"username"`
+	ProfilePicture string `json:"profilePicture,omitempty" db:"profile_picture"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// Page is the response envelope for paginated list endpoints
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
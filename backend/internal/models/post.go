@@ -4,28 +4,115 @@ import (
 	"time"
 )
 
-// Post represents a user post (image or video)
+// Post statuses. Posts are created as processing while their media is
+// compressed in the background and become ready once it is stored, or failed
+// if it can't be. Moderators can take a post down by marking it removed.
+// Only ready posts are shown to anyone but their owner.
+const (
+	PostStatusProcessing = "processing"
+	PostStatusReady      = "ready"
+	PostStatusFailed     = "failed"
+	PostStatusRemoved    = "removed"
+)
+
+// MaxPostMedia is the most images and videos a single post can hold
+const MaxPostMedia = 10
+
+// Post represents a user post of up to MaxPostMedia images and videos
 type Post struct {
+	ID            string      `json:"id" db:"id"`
+	UserID        string      `json:"userId" db:"user_id"`
+	Username      string      `json:"username" db:"username"`
+	Caption       string      `json:"caption" db:"caption"`
+	Entities      Entities    `json:"entities,omitempty" db:"caption_entities"` // Mentions and hashtags in Caption
+	MediaKey      string      `json:"-" db:"media_key"`                         // Storage object key
+	MediaURL      string      `json:"mediaUrl" db:"-"`                          // Rendered from MediaKey at response time
+	MediaType     string      `json:"mediaType" db:"media_type"`
+	ThumbnailKey  *string     `json:"-" db:"thumbnail_key"`          // Poster frame for videos
+	ThumbnailURL  *string     `json:"thumbnailUrl,omitempty" db:"-"` // Rendered from ThumbnailKey
+	PlaylistKey   *string     `json:"-" db:"playlist_key"`           // HLS master playlist for videos
+	PlaylistURL   *string     `json:"playlistUrl,omitempty" db:"-"`  // Rendered from PlaylistKey; MediaURL is the MP4 fallback
+	Width         *int        `json:"width,omitempty" db:"width"`
+	Height        *int        `json:"height,omitempty" db:"height"`
+	BlurHash      *string     `json:"blurhash,omitempty" db:"blurhash"`            // Painted until the media loads
+	DominantColor *string     `json:"dominantColor,omitempty" db:"dominant_color"` // e.g. "#4a6b8c"
+	Status        string      `json:"status" db:"status"`
+	StatusReason  *string     `json:"statusReason,omitempty" db:"status_reason"` // Why the post failed or was removed
+	Likes         int         `json:"likes" db:"likes"`
+	Liked         bool        `json:"liked,omitempty" db:"-"` // New field to indicate if current user liked the post
+	CreatedAt     time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updatedAt" db:"updated_at"`
+	Renditions    []Rendition `json:"renditions,omitempty" db:"-"` // The first item's renditions
+	Media         []PostMedia `json:"media,omitempty" db:"-"`      // Every item, in order; the fields above describe the first
+	Comments      []Comment   `json:"comments,omitempty" db:"-"`   // Newest comments only when listed in a feed
+	CommentCount  int         `json:"commentCount" db:"-"`
+}
+
+// PostMedia is one image or video of a post
+type PostMedia struct {
+	PostID        string      `json:"-" db:"post_id"`
+	Position      int         `json:"position" db:"position"`
+	MediaKey      string      `json:"-" db:"media_key"`
+	MediaURL      string      `json:"mediaUrl" db:"-"`
+	MediaType     string      `json:"mediaType" db:"media_type"`
+	ThumbnailKey  *string     `json:"-" db:"thumbnail_key"`
+	ThumbnailURL  *string     `json:"thumbnailUrl,omitempty" db:"-"`
+	PlaylistKey   *string     `json:"-" db:"playlist_key"`
+	PlaylistURL   *string     `json:"playlistUrl,omitempty" db:"-"`
+	Width         *int        `json:"width,omitempty" db:"width"` // Of the image or video thumbnail
+	Height        *int        `json:"height,omitempty" db:"height"`
+	BlurHash      *string     `json:"blurhash,omitempty" db:"blurhash"`
+	DominantColor *string     `json:"dominantColor,omitempty" db:"dominant_color"`
+	CapturedAt    *time.Time  `json:"capturedAt,omitempty" db:"captured_at"` // Retained image metadata, when enabled
+	CreatedAt     time.Time   `json:"-" db:"created_at"`
+	Renditions    []Rendition `json:"renditions,omitempty" db:"-"` // Images only
+	Hashes        []uint64    `json:"-" db:"-"`                    // Perceptual hashes, set while processing
+}
+
+// Rendition is one size and format of an image. Clients build a srcset from
+// the renditions of the formats they support and pick the smallest that fits.
+type Rendition struct {
+	PostID      string `json:"-" db:"post_id"`
+	Position    int    `json:"-" db:"position"`
+	Width       int    `json:"width" db:"width"`
+	Height      int    `json:"height" db:"height"`
+	ContentType string `json:"type" db:"content_type"`
+	MediaKey    string `json:"-" db:"media_key"`
+	URL         string `json:"url" db:"-"`
+}
+
+// BlockedHash is the perceptual hash of media taken down by a moderator.
+// Uploads that match it closely are rejected.
+type BlockedHash struct {
 	ID        string    `json:"id" db:"id"`
-	UserID    string    `json:"userId" db:"user_id"`
-	Username  string    `json:"username" db:"username"`
-	Caption   string    `json:"caption" db:"caption"`
-	MediaURL  string    `json:"mediaUrl" db:"media_url"`
-	MediaType string    `json:"mediaType" db:"media_type"`
-	Likes     int       `json:"likes" db:"likes"`
-	Liked     bool      `json:"liked,omitempty" db:"-"` // New field to indicate if current user liked the post
+	Hash      int64     `json:"-" db:"hash"`
+	HashHex   string    `json:"hash" db:"-"` // Rendered from Hash
+	Reason    string    `json:"reason" db:"reason"`
+	PostID    *string   `json:"postId,omitempty" db:"post_id"` // The post it was taken from
+	CreatedBy *string   `json:"createdBy,omitempty" db:"created_by"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
-	Comments  []Comment `json:"comments,omitempty" db:"-"`
 }
 
-// Comment represents a comment on a post
+// MaxCommentDepth is how deeply replies nest. Replies to top-level comments
+// are at depth 1 and replies to those at depth 2; replying to a comment at
+// the maximum depth adds to its parent's replies instead.
+const MaxCommentDepth = 2
+
+// Comment represents a comment on a post or a reply to another comment
 type Comment struct {
-	ID        string    `json:"id" db:"id"`
-	PostID    string    `json:"postId" db:"post_id"`
-	UserID    string    `json:"userId" db:"user_id"`
-	Username  string    `json:"username" db:"username"`
-	Content   string    `json:"content" db:"content"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID              string     `json:"id" db:"id"`
+	PostID          string     `json:"postId" db:"post_id"`
+	ParentCommentID *string    `json:"parentCommentId,omitempty" db:"parent_comment_id"`
+	Depth           int        `json:"depth" db:"depth"`
+	UserID          *string    `json:"userId,omitempty" db:"user_id"` // Nil for tombstones
+	Username        string     `json:"username" db:"username"`
+	Content         string     `json:"content" db:"content"`
+	Entities        Entities   `json:"entities,omitempty" db:"content_entities"` // Mentions and hashtags in Content
+	ReplyCount      int        `json:"replyCount" db:"reply_count"`              // Direct replies, when listed
+	Likes           int        `json:"likes" db:"likes"`
+	Liked           bool       `json:"liked,omitempty" db:"-"`   // Whether the current user liked the comment
+	Deleted         bool       `json:"deleted,omitempty" db:"-"` // A tombstone kept for its replies
+	DeletedAt       *time.Time `json:"-" db:"deleted_at"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updatedAt" db:"updated_at"`
 }
@@ -8,16 +8,16 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID             string         `json:"id" db:"id"`
-	Username       string         `json:"username" db:"username"`
-	Email          string         `json:"email" db:"email"`
-	PasswordHash   string         `json:"-" db:"password_hash"`
-	Name           sql.NullString `json:"name,omitempty" db:"name"`
-	PhoneNumber    sql.NullString `json:"phoneNumber,omitempty" db:"phone_number"`
-	ProfilePicture sql.NullString `json:"profilePicture,omitempty" db:"profile_picture"`
-	IsAdmin        bool           `json:"isAdmin" db:"is_admin"`
-	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time      `json:"updatedAt" db:"updated_at"`
+	ID                string         `json:"id" db:"id"`
+	Username          string         `json:"username" db:"username"`
+	Email             string         `json:"email" db:"email"`
+	PasswordHash      string         `json:"-" db:"password_hash"`
+	Name              sql.NullString `json:"name,omitempty" db:"name"`
+	PhoneNumber       sql.NullString `json:"phoneNumber,omitempty" db:"phone_number"`
+	ProfilePictureKey sql.NullString `json:"-" db:"profile_picture_key"` // Rendered as UserResponse.ProfilePicture
+	IsAdmin           bool           `json:"isAdmin" db:"is_admin"`
+	CreatedAt         time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time      `json:"updatedAt" db:"updated_at"`
 }
 
 // UserResponse is the public representation of a user
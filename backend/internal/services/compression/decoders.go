@@ -0,0 +1,234 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/webp"
+)
+
+// Decoder reads one image format. Decoders are tried in the order they were
+// registered, so preferred decoders for a format are registered first.
+type Decoder struct {
+	Name      string                 // Identifies the decoder in logs and on the health endpoint
+	Format    string                 // Format it reads, e.g. "heic"
+	Tool      string                 // External command it runs, or "" for pure Go decoders
+	ProbeArgs []string               // Arguments that make Tool print its version, to check it runs
+	Match     func(data []byte) bool // Reports whether data is in Format
+	Decode    func(ctx context.Context, data []byte) (image.Image, error)
+}
+
+// DecoderStatus reports whether a registered decoder can be used
+type DecoderStatus struct {
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Tool      string `json:"tool,omitempty"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ErrUnsupportedFormat is returned for data that no registered decoder reads
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// DecoderUnavailableError is returned when an image's format is recognized but
+// every decoder for it depends on an external tool that isn't installed
+type DecoderUnavailableError struct {
+	Format string
+	Tools  []string // Any one of these would do
+}
+
+func (e *DecoderUnavailableError) Error() string {
+	return fmt.Sprintf("no decoder available for %s images, install one of: %s", e.Format, strings.Join(e.Tools, ", "))
+}
+
+// DecodeError is returned when the decoders for an image's format all failed
+// to read it, usually because the file is corrupt
+type DecodeError struct {
+	Format string
+	Err    error // The last decoder's error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %s image: %v", e.Format, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// registeredDecoder is a decoder along with the result of probing its tool
+type registeredDecoder struct {
+	Decoder
+	probeErr error
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   []*registeredDecoder
+	probeOnce  sync.Once
+)
+
+// RegisterDecoder adds a decoder to the registry. Decoders that run an
+// external tool are only used once ProbeDecoders has found the tool.
+func RegisterDecoder(decoder Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders = append(decoders, &registeredDecoder{Decoder: decoder})
+}
+
+// ProbeDecoders checks once which external tools are installed and logs the
+// result. Later calls return the statuses found by the first.
+func ProbeDecoders() []DecoderStatus {
+	probeOnce.Do(func() {
+		decodersMu.Lock()
+		defer decodersMu.Unlock()
+
+		for _, decoder := range decoders {
+			if decoder.Tool == "" {
+				continue
+			}
+			decoder.probeErr = probeTool(decoder.Tool, decoder.ProbeArgs)
+			if decoder.probeErr != nil {
+				log.Printf("Image decoder %s (%s) unavailable: %v", decoder.Name, decoder.Format, decoder.probeErr)
+			} else {
+				log.Printf("✓ Image decoder %s (%s) found", decoder.Name, decoder.Format)
+			}
+		}
+	})
+	return DecoderStatuses()
+}
+
+// probeTool checks that an external command exists and runs
+func probeTool(tool string, args []string) error {
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+		if err := exec.CommandContext(ctx, path, args...).Run(); err != nil {
+			return fmt.Errorf("%s did not run: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// DecoderStatuses returns the status of every registered decoder
+func DecoderStatuses() []DecoderStatus {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	statuses := make([]DecoderStatus, len(decoders))
+	for i, decoder := range decoders {
+		statuses[i] = DecoderStatus{
+			Name:      decoder.Name,
+			Format:    decoder.Format,
+			Tool:      decoder.Tool,
+			Available: decoder.probeErr == nil,
+		}
+		if decoder.probeErr != nil {
+			statuses[i].Error = decoder.probeErr.Error()
+		}
+	}
+	return statuses
+}
+
+// CanDecode reports whether some available decoder reads format
+func CanDecode(format string) bool {
+	ProbeDecoders()
+
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	for _, decoder := range decoders {
+		if decoder.Format == format && decoder.probeErr == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeImage decodes an image with the first available decoder that
+// recognizes it, trying the next on failure. It returns the image's format.
+func DecodeImage(ctx context.Context, data []byte) (image.Image, string, error) {
+	ProbeDecoders()
+
+	decodersMu.RLock()
+	var matched []*registeredDecoder
+	for _, decoder := range decoders {
+		if decoder.Match(data) {
+			matched = append(matched, decoder)
+		}
+	}
+	decodersMu.RUnlock()
+
+	if len(matched) == 0 {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	format := matched[0].Format
+	var lastErr error
+	var missing []string
+	for _, decoder := range matched {
+		if decoder.probeErr != nil {
+			missing = append(missing, decoder.Tool)
+			continue
+		}
+		img, err := decoder.Decode(ctx, data)
+		if err == nil {
+			return img, decoder.Format, nil
+		}
+		if ctx.Err() != nil {
+			return nil, format, ctx.Err()
+		}
+		log.Printf("Image decoder %s failed: %v", decoder.Name, err)
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return nil, format, &DecoderUnavailableError{Format: format, Tools: missing}
+	}
+	return nil, format, &DecodeError{Format: format, Err: lastErr}
+}
+
+// DecodeImageConfig reads an image's dimensions from its header without
+// decoding its pixels
+func DecodeImageConfig(data []byte) (image.Config, error) {
+	if isHEIC(data) {
+		return heic.DecodeConfig(bytes.NewReader(data))
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return config, err
+}
+
+// The formats Go decodes natively
+func init() {
+	RegisterDecoder(Decoder{
+		Name:   "go-jpeg",
+		Format: "jpeg",
+		Match:  func(data []byte) bool { return bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}) },
+		Decode: func(_ context.Context, data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) },
+	})
+	RegisterDecoder(Decoder{
+		Name:   "go-png",
+		Format: "png",
+		Match:  func(data []byte) bool { return bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) },
+		Decode: func(_ context.Context, data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) },
+	})
+	RegisterDecoder(Decoder{
+		Name:   "go-webp",
+		Format: "webp",
+		Match: func(data []byte) bool {
+			return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+		},
+		Decode: func(_ context.Context, data []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(data)) },
+	})
+}
@@ -0,0 +1,255 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// ImageMetadata is what CompressImage keeps from an image's embedded metadata.
+// Everything else, including GPS position and camera details, is dropped when
+// the image is re-encoded.
+type ImageMetadata struct {
+	Width      int        // After orientation and resizing
+	Height     int        // After orientation and resizing
+	CapturedAt *time.Time // From EXIF DateTimeOriginal, if present
+	Stripped   []string   // Kinds of metadata found and removed, e.g. "gps"
+}
+
+// EXIF tags read from the image
+const (
+	tagOrientation      = 0x0112
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagCameraOwner      = 0xa430
+	tagBodySerialNumber = 0xa431
+	tagLensMake         = 0xa433
+	tagLensModel        = 0xa434
+	tagLensSerialNumber = 0xa435
+)
+
+// Tags identifying the device that took the photo or its owner
+var deviceTags = []uint16{
+	tagMake, tagModel, tagSoftware, tagCameraOwner,
+	tagBodySerialNumber, tagLensMake, tagLensModel, tagLensSerialNumber,
+}
+
+// exifTimeLayout is the format of EXIF date fields
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// jpegMetadata is what readJPEGMetadata found in a JPEG's header segments
+type jpegMetadata struct {
+	orientation int
+	capturedAt  *time.Time
+	stripped    []string
+}
+
+// readJPEGMetadata scans a JPEG's header segments for EXIF and other embedded
+// metadata. Unreadable or missing metadata is not an error; the image is
+// simply treated as having none.
+func readJPEGMetadata(data []byte) jpegMetadata {
+	meta := jpegMetadata{orientation: 1}
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return meta
+	}
+
+	found := map[string]bool{}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		marker := data[pos+1]
+		// Image data follows the start of scan marker, so there is no more metadata
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		pos += 2 + length
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			readEXIF(segment[6:], &meta, found)
+		case marker == 0xe1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/xap/1.0/")):
+			found["xmp"] = true
+		case marker == 0xed:
+			found["iptc"] = true
+		case marker == 0xe2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE")):
+			found["icc_profile"] = true
+		case marker == 0xfe:
+			found["comment"] = true
+		}
+	}
+
+	for _, kind := range []string{"gps", "device", "exif", "xmp", "iptc", "icc_profile", "comment"} {
+		if found[kind] {
+			meta.stripped = append(meta.stripped, kind)
+		}
+	}
+	return meta
+}
+
+// readEXIF reads the orientation and capture time from a TIFF-structured EXIF
+// block and notes which kinds of sensitive metadata it contains
+func readEXIF(tiff []byte, meta *jpegMetadata, found map[string]bool) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	found["exif"] = true
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:8]))
+	if entry, ok := ifd0[tagOrientation]; ok {
+		if orientation := int(entry.value(order)); orientation >= 1 && orientation <= 8 {
+			meta.orientation = orientation
+		}
+	}
+	if _, ok := ifd0[tagGPSIFD]; ok {
+		found["gps"] = true
+	}
+
+	exifIFD := map[uint16]ifdEntry{}
+	if entry, ok := ifd0[tagExifIFD]; ok {
+		exifIFD = readIFD(tiff, order, entry.value(order))
+	}
+	for _, tag := range deviceTags {
+		_, inIFD0 := ifd0[tag]
+		_, inExif := exifIFD[tag]
+		if inIFD0 || inExif {
+			found["device"] = true
+		}
+	}
+
+	// Prefer when the photo was taken over when the file was last changed
+	for _, candidate := range []struct {
+		ifd map[uint16]ifdEntry
+		tag uint16
+	}{{exifIFD, tagDateTimeOriginal}, {ifd0, tagDateTime}} {
+		entry, ok := candidate.ifd[candidate.tag]
+		if !ok {
+			continue
+		}
+		if t, err := time.Parse(exifTimeLayout, entry.ascii(tiff, order)); err == nil {
+			meta.capturedAt = &t
+			break
+		}
+	}
+}
+
+// ifdEntry is a single field of an EXIF image file directory
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	raw   []byte // The 4 byte value or offset field
+}
+
+// value returns a SHORT or LONG field's value
+func (e ifdEntry) value(order binary.ByteOrder) uint32 {
+	if e.typ == 3 {
+		return uint32(order.Uint16(e.raw))
+	}
+	return order.Uint32(e.raw)
+}
+
+// ascii returns an ASCII field's text without its terminating NUL
+func (e ifdEntry) ascii(tiff []byte, order binary.ByteOrder) string {
+	if e.typ != 2 {
+		return ""
+	}
+	text := e.raw
+	if e.count > 4 {
+		offset := order.Uint32(e.raw)
+		if uint64(offset)+uint64(e.count) > uint64(len(tiff)) {
+			return ""
+		}
+		text = tiff[offset : offset+e.count]
+	} else {
+		text = text[:e.count]
+	}
+	return string(bytes.TrimRight(text, "\x00 "))
+}
+
+// readIFD reads the fields of the directory at offset, keyed by tag
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]ifdEntry {
+	entries := map[uint16]ifdEntry{}
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return entries
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	for i := 0; i < count; i++ {
+		pos := start + i*12
+		if pos+12 > len(tiff) {
+			break
+		}
+		tag := order.Uint16(tiff[pos:])
+		entries[tag] = ifdEntry{
+			typ:   order.Uint16(tiff[pos+2:]),
+			count: order.Uint32(tiff[pos+4:]),
+			raw:   tiff[pos+8 : pos+12],
+		}
+	}
+	return entries
+}
+
+// applyOrientation rotates and flips an image so it displays upright, given
+// its EXIF orientation (1-8). Orientation 1 is returned unchanged.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Orientations 5-8 are rotated a quarter turn, which swaps the dimensions
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // Mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			i := src.PixOffset(x, y)
+			j := dst.PixOffset(dx, dy)
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,212 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned when an external tool runs longer than the
+// configured transcode timeout
+var ErrTimeout = errors.New("media processing timed out")
+
+// How long ffprobe may take to read a file's headers
+const probeTimeout = time.Minute
+
+// Most stderr kept for error messages; ffmpeg puts the cause at the end
+const maxStderr = 2048
+
+var (
+	runnerMu         sync.Mutex
+	transcodeSlots   = make(chan struct{}, defaultTranscodes())
+	transcodeTimeout = 15 * time.Minute
+)
+
+// defaultTranscodes leaves half the CPUs free, since each ffmpeg run is itself
+// multi-threaded
+func defaultTranscodes() int {
+	if n := runtime.NumCPU() / 2; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// ConfigureRunner sets how many external tools (ffmpeg, ImageMagick, ...) may
+// transcode at once across the whole process and how long each run may take.
+// Call it at startup, before any media is processed.
+func ConfigureRunner(maxConcurrent int, timeout time.Duration) {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	if maxConcurrent > 0 {
+		transcodeSlots = make(chan struct{}, maxConcurrent)
+	}
+	if timeout > 0 {
+		transcodeTimeout = timeout
+	}
+}
+
+// Progress is how far a running ffmpeg command has got through its input
+type Progress struct {
+	Time  time.Duration // Position in the output
+	Speed float64       // Multiple of real time, 0 if unknown
+	Done  bool
+}
+
+// VideoToolRuns returns the most tool runs processing one video takes, each
+// limited to the runner's timeout: keyframe hashing, one per HLS rendition,
+// conversion to MP4 and the thumbnail
+func VideoToolRuns() int {
+	return 3 + len(HLSRenditions)
+}
+
+// runFFmpeg runs ffmpeg once a transcode slot is free. If onProgress is set
+// it is called with the progress ffmpeg reports about once a second.
+func runFFmpeg(ctx context.Context, args []string, onProgress func(Progress)) error {
+	base := []string{"-hide_banner", "-nostdin", "-loglevel", "error"}
+	if onProgress != nil {
+		base = append(base, "-nostats", "-progress", "pipe:1")
+	}
+	return runTool(ctx, "ffmpeg", append(base, args...), onProgress)
+}
+
+// runTool runs an external media tool under the shared concurrency limit and
+// per-run timeout. Its stderr is included in the returned error.
+func runTool(ctx context.Context, name string, args []string, onProgress func(Progress)) error {
+	runnerMu.Lock()
+	slots, timeout := transcodeSlots, transcodeTimeout
+	runnerMu.Unlock()
+
+	// Wait for a free slot
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Stderr = &stderr
+
+	var progressDone chan struct{}
+	if onProgress != nil {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return fmt.Errorf("failed to read %s progress: %w", name, err)
+		}
+		progressDone = make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			parseProgress(stdout, onProgress)
+		}()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s failed to start: %w", name, err)
+	}
+	if progressDone != nil {
+		<-progressDone
+	}
+	err := cmd.Wait()
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		// Cancelled by the caller, e.g. on shutdown
+		return ctx.Err()
+	case runCtx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("%s ran longer than %s: %w", name, timeout, ErrTimeout)
+	}
+	return fmt.Errorf("%s failed: %w: %s", name, err, stderrTail(stderr.Bytes()))
+}
+
+// runProbe runs ffprobe and returns its output. Probes only read headers, so
+// they don't wait for a transcode slot.
+func runProbe(ctx context.Context, args ...string) ([]byte, error) {
+	runCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, "ffprobe", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("ffprobe ran longer than %s: %w", probeTimeout, ErrTimeout)
+		}
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, stderrTail(stderr.Bytes()))
+	}
+	return output, nil
+}
+
+// stderrTail returns the end of a tool's stderr, trimmed for an error message
+func stderrTail(stderr []byte) string {
+	stderr = bytes.TrimSpace(stderr)
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	return string(stderr)
+}
+
+// parseProgress reads the key=value blocks written by ffmpeg -progress and
+// reports each completed block
+func parseProgress(r io.Reader, onProgress func(Progress)) {
+	var progress Progress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				progress.Time = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			progress.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			// Last key of each block
+			progress.Done = value == "end"
+			onProgress(progress)
+		}
+	}
+	// Keep draining so ffmpeg never blocks writing progress
+	io.Copy(io.Discard, r)
+}
+
+// logProgress returns a progress callback that logs every quarter of the way
+// through an input of the given duration
+func logProgress(label string, duration time.Duration) func(Progress) {
+	if duration <= 0 {
+		return nil
+	}
+	nextQuarter := 1
+	return func(p Progress) {
+		percent := int(100 * p.Time / duration)
+		if p.Done {
+			percent = 100
+		}
+		for nextQuarter <= 4 && percent >= nextQuarter*25 {
+			log.Printf("%s: %d%% (%.1fx)", label, nextQuarter*25, p.Speed)
+			nextQuarter++
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package compression
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Progress
+	}{
+		{
+			name:   "no output",
+			output: "",
+			want:   nil,
+		},
+		{
+			name: "single block",
+			output: "frame=25\nfps=0.0\nout_time_us=1000000\nout_time=00:00:01.000000\n" +
+				"speed=2.5x\nprogress=continue\n",
+			want: []Progress{{Time: time.Second, Speed: 2.5}},
+		},
+		{
+			name: "until the end",
+			output: "out_time_us=500000\nspeed=1x\nprogress=continue\n" +
+				"out_time_us=2000000\nspeed=1.25x\nprogress=end\n",
+			want: []Progress{
+				{Time: 500 * time.Millisecond, Speed: 1},
+				{Time: 2 * time.Second, Speed: 1.25, Done: true},
+			},
+		},
+		{
+			name:   "unknown speed",
+			output: "out_time_us=1000\nspeed=N/A\nprogress=continue\n",
+			want:   []Progress{{Time: time.Millisecond}},
+		},
+		{
+			// ffmpeg reports a negative time before the first frame
+			name:   "negative time is ignored",
+			output: "out_time_us=3000000\nprogress=continue\nout_time_us=-9223372036854775807\nprogress=continue\n",
+			want:   []Progress{{Time: 3 * time.Second}, {Time: 3 * time.Second}},
+		},
+		{
+			name:   "windows line endings and noise",
+			output: "out_time_us=1000000\r\nnot a key value\r\n\r\nprogress=end\r\n",
+			want:   []Progress{{Time: time.Second, Done: true}},
+		},
+		{
+			name:   "incomplete block is not reported",
+			output: "out_time_us=1000000\nspeed=1x\nprogress=continue\nout_time_us=2000000\n",
+			want:   []Progress{{Time: time.Second, Speed: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Progress
+			parseProgress(strings.NewReader(tt.output), func(p Progress) {
+				got = append(got, p)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProgress() reported %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+
+	"github.com/gen2brain/heic"
+)
+
+// HEIC images are decoded in process by libheif compiled to WebAssembly, which
+// needs no external tool. The converters below are only tried if it fails on a
+// file, and are skipped unless installed.
+func init() {
+	RegisterDecoder(Decoder{
+		Name:   "go-heic",
+		Format: "heic",
+		Match:  isHEIC,
+		Decode: func(_ context.Context, data []byte) (image.Image, error) { return heic.Decode(bytes.NewReader(data)) },
+	})
+	RegisterDecoder(Decoder{
+		Name:      "imagemagick",
+		Format:    "heic",
+		Tool:      "convert",
+		ProbeArgs: []string{"-version"},
+		Match:     isHEIC,
+		Decode: func(ctx context.Context, data []byte) (image.Image, error) {
+			return convertHEIC(data, func(input, output string) error {
+				return runTool(ctx, "convert", []string{input, output}, nil)
+			})
+		},
+	})
+	RegisterDecoder(Decoder{
+		Name:   "libheif",
+		Format: "heic",
+		Tool:   "heif-convert",
+		Match:  isHEIC,
+		Decode: func(ctx context.Context, data []byte) (image.Image, error) {
+			return convertHEIC(data, func(input, output string) error {
+				return runTool(ctx, "heif-convert", []string{"-q", "95", input, output}, nil)
+			})
+		},
+	})
+	RegisterDecoder(Decoder{
+		Name:      "ffmpeg",
+		Format:    "heic",
+		Tool:      "ffmpeg",
+		ProbeArgs: []string{"-version"},
+		Match:     isHEIC,
+		Decode: func(ctx context.Context, data []byte) (image.Image, error) {
+			return convertHEIC(data, func(input, output string) error {
+				return runFFmpeg(ctx, []string{"-i", input, "-q:v", "2", output}, nil)
+			})
+		},
+	})
+}
+
+// isHEIC checks if data is in HEIC format based on magic bytes
+func isHEIC(data []byte) bool {
+	if len(data) < 12 {
+		return false
+	}
+
+	// HEIC files typically start with ftyp marker
+	if bytes.Equal(data[4:8], []byte("ftyp")) {
+		// Check for HEIC brand
+		switch string(data[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return true
+		}
+	}
+	return false
+}
+
+// convertHEIC converts a HEIC image to JPEG with convert and decodes the
+// result. The converters apply the rotation stored in the HEIC container
+// themselves.
+func convertHEIC(data []byte, convert func(input, output string) error) (image.Image, error) {
+	// Create temporary directories
+	tempDir, err := os.MkdirTemp("", "heic_conversion")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Write HEIC data to temp file
+	heicPath := filepath.Join(tempDir, "input.heic")
+	if err := os.WriteFile(heicPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write temp HEIC file: %w", err)
+	}
+
+	// Define output JPEG path
+	jpegPath := filepath.Join(tempDir, "output.jpg")
+
+	if err := convert(heicPath, jpegPath); err != nil {
+		return nil, err
+	}
+
+	// Read the converted JPEG file
+	jpegData, err := os.ReadFile(jpegPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read converted JPEG file: %w", err)
+	}
+
+	return jpeg.Decode(bytes.NewReader(jpegData))
+}
@@ -0,0 +1,189 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HLSRendition is one quality level of an HLS stream
+type HLSRendition struct {
+	Height  int
+	Bitrate int // Video bitrate in bits per second
+}
+
+// HLSRenditions are the quality levels produced for each video, smallest
+// first. Levels taller than the source video are skipped.
+var HLSRenditions = []HLSRendition{
+	{Height: 360, Bitrate: 800_000},
+	{Height: 720, Bitrate: 2_800_000},
+	{Height: 1080, Bitrate: 5_000_000},
+}
+
+// HLSMasterPlaylist is the name of the playlist that lists every rendition
+const HLSMasterPlaylist = "master.m3u8"
+
+// Audio bitrate used for every rendition
+const hlsAudioBitrate = 128_000
+
+// VideoInfo describes a video's first video stream
+type VideoInfo struct {
+	Width    int
+	Height   int
+	Duration float64 // Seconds
+}
+
+// ProbeVideo reads a video's dimensions and duration with ffprobe
+func ProbeVideo(ctx context.Context, path string) (VideoInfo, error) {
+	output, err := runProbe(
+		ctx,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height:format=duration",
+		"-of", "default=noprint_wrappers=1",
+		path,
+	)
+	if err != nil {
+		return VideoInfo{}, err
+	}
+
+	var info VideoInfo
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "width":
+			info.Width, _ = strconv.Atoi(value)
+		case "height":
+			info.Height, _ = strconv.Atoi(value)
+		case "duration":
+			info.Duration, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	if info.Width == 0 || info.Height == 0 {
+		return VideoInfo{}, fmt.Errorf("no video stream found")
+	}
+	return info, nil
+}
+
+// ProbeVideoData is ProbeVideo for a video held in memory
+func ProbeVideoData(ctx context.Context, data []byte, fileName string) (VideoInfo, error) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "video_probe")
+	if err != nil {
+		return VideoInfo{}, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(fileName))
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return VideoInfo{}, fmt.Errorf("failed to write input file: %w", err)
+	}
+
+	return ProbeVideo(ctx, inputPath)
+}
+
+// CreateHLS transcodes a video into the HLS renditions that fit its size. It
+// returns every file of the stream keyed by its path relative to the master
+// playlist, which references the renditions by relative URI.
+func CreateHLS(ctx context.Context, data []byte, fileName string) (map[string][]byte, error) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "video_hls")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create input file
+	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(fileName))
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write input file: %w", err)
+	}
+
+	source, err := ProbeVideo(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir := filepath.Join(tempDir, "hls")
+	var master bytes.Buffer
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for i, rendition := range HLSRenditions {
+		// Never upscale, but always produce at least the smallest rendition
+		if rendition.Height > source.Height && i > 0 {
+			break
+		}
+
+		name := fmt.Sprintf("%dp", rendition.Height)
+		renditionDir := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(renditionDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create rendition directory: %w", err)
+		}
+
+		args := []string{
+			"-i", inputPath,
+			"-vf", fmt.Sprintf("scale=-2:%d", rendition.Height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-b:v", strconv.Itoa(rendition.Bitrate),
+			"-maxrate", strconv.Itoa(rendition.Bitrate * 107 / 100),
+			"-bufsize", strconv.Itoa(rendition.Bitrate * 3 / 2),
+			"-g", "48", "-keyint_min", "48", "-sc_threshold", "0",
+			"-c:a", "aac",
+			"-b:a", strconv.Itoa(hlsAudioBitrate),
+			"-hls_time", "6",
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(renditionDir, "segment_%03d.ts"),
+			filepath.Join(renditionDir, "index.m3u8"),
+		}
+		progress := logProgress("HLS "+name, time.Duration(source.Duration*float64(time.Second)))
+		if err := runFFmpeg(ctx, args, progress); err != nil {
+			return nil, fmt.Errorf("HLS rendition %s: %w", name, err)
+		}
+
+		// Width as produced by scale=-2, rounded to an even number
+		width := (source.Width*rendition.Height/source.Height + 1) / 2 * 2
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n",
+			rendition.Bitrate+hlsAudioBitrate, width, rendition.Height, name)
+	}
+
+	// Collect the generated files
+	files := map[string][]byte{HLSMasterPlaylist: master.Bytes()}
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HLS output: %w", err)
+	}
+
+	return files, nil
+}
+
+// HLSContentType returns the content type for a file produced by CreateHLS
+func HLSContentType(name string) string {
+	if strings.HasSuffix(name, ".m3u8") {
+		return "application/vnd.apple.mpegurl"
+	}
+	return "video/mp2t"
+}
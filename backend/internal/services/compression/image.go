@@ -2,16 +2,12 @@ package compression
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
-	"image/png"
-	"os"
-	"os/exec"
-	"path/filepath"
 
 	"golang.org/x/image/draw"
-	_ "golang.org/x/image/webp" // Register WebP format
 )
 
 // Maximum dimensions for compressed images
@@ -21,21 +17,45 @@ const (
 	JpegQuality = 85
 )
 
-// CompressImage compresses an image to reduce file size
-func CompressImage(data []byte, contentType string) ([]byte, error) {
-	// Add format conversion for non-standard image formats
-	var err error
-	data, contentType, err = ConvertImageFormat(data, contentType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert image format: %w", err)
-	}
+// AvatarSizes are the square edge lengths (in pixels) generated for profile pictures
+var AvatarSizes = []int{64, 256, 512}
+
+// DefaultAvatarSize is the rendition stored as the user's profile picture
+const DefaultAvatarSize = 256
+
+// CompressedImage is the result of CompressImage
+type CompressedImage struct {
+	Data        []byte
+	ContentType string      // image/png for PNG uploads, image/jpeg for everything else
+	Image       image.Image // The upright, resized image Data was encoded from
+	Metadata    ImageMetadata
+}
+
+// CompressImage compresses an image to reduce file size. The format is
+// detected from the data and decoded by the decoder registry, so errors may be
+// ErrUnsupportedFormat, *DecoderUnavailableError or *DecodeError. The image is
+// turned upright according to its EXIF orientation and re-encoded from pixels
+// alone, so no embedded metadata (GPS position, camera details, etc.)
+// survives; the returned ImageMetadata records what was kept and what was
+// removed.
+func CompressImage(ctx context.Context, data []byte) (*CompressedImage, error) {
+	var metadata ImageMetadata
+
+	// Read the metadata before it is discarded
+	exif := readJPEGMetadata(data)
+	metadata.CapturedAt = exif.capturedAt
+	metadata.Stripped = exif.stripped
 
 	// Decode image
-	img, _, err := image.Decode(bytes.NewReader(data))
+	img, format, err := DecodeImage(ctx, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, err
 	}
 
+	// Orientation must be applied before resizing, since it can swap the
+	// width and height
+	img = applyOrientation(img, exif.orientation)
+
 	// Get original dimensions
 	bounds := img.Bounds()
 	origWidth := bounds.Dx()
@@ -67,112 +87,59 @@ func CompressImage(data []byte, contentType string) ([]byte, error) {
 		newHeight = origHeight
 	}
 
-	// Encode image with compression
-	var buf bytes.Buffer
-	switch contentType {
-	case "image/jpeg":
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JpegQuality})
-	case "image/png":
-		err = png.Encode(&buf, img)
-	default:
-		// Default to JPEG for other formats
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JpegQuality})
-	}
-
+	// Encode image with compression, keeping PNG (and its transparency) for
+	// PNG uploads and using JPEG for everything else
+	encoded, encodedType, err := encodeImage(img, "image/"+format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode compressed image: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	metadata.Width = newWidth
+	metadata.Height = newHeight
+	return &CompressedImage{
+		Data:        encoded,
+		ContentType: encodedType,
+		Image:       img,
+		Metadata:    metadata,
+	}, nil
 }
 
-// ConvertImageFormat converts non-standard image formats (like HEIC) to JPEG
-func ConvertImageFormat(data []byte, contentType string) ([]byte, string, error) {
-	// Check if conversion is needed
-	switch contentType {
-	case "image/heic", "image/heif":
-		return convertHEIC(data)
-	case "image/jpeg", "image/png", "image/webp":
-		// Already supported formats
-		return data, contentType, nil
-	default:
-		// Try to detect format from magic bytes
-		if isHEIC(data) {
-			return convertHEIC(data)
-		}
-		// For other unrecognized formats, try to decode and re-encode as JPEG
-		img, _, err := image.Decode(bytes.NewReader(data))
-		if err != nil {
-			// If we can't decode, return original data
-			return data, contentType, nil
-		}
-
-		var buf bytes.Buffer
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JpegQuality})
-		if err != nil {
-			return data, contentType, nil
-		}
-
-		return buf.Bytes(), "image/jpeg", nil
+// CreateAvatar compresses an uploaded profile picture, center-crops it to a
+// square and returns a JPEG rendition for each of AvatarSizes, keyed by size
+func CreateAvatar(ctx context.Context, data []byte) (map[int][]byte, error) {
+	compressed, err := CompressImage(ctx, data)
+	if err != nil {
+		return nil, err
 	}
-}
+	img := compressed.Image
 
-// isHEIC checks if data is in HEIC format based on magic bytes
-func isHEIC(data []byte) bool {
-	if len(data) < 12 {
-		return false
+	// Crop the largest centered square
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
 	}
-
-	// HEIC files typically start with ftyp marker
-	if bytes.Equal(data[4:8], []byte("ftyp")) {
-		// Check for HEIC brand
-		if bytes.Equal(data[8:12], []byte("heic")) ||
-			bytes.Equal(data[8:12], []byte("heix")) ||
-			bytes.Equal(data[8:12], []byte("hevc")) ||
-			bytes.Equal(data[8:12], []byte("mif1")) {
-			return true
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x0, y0, x0+side, y0+side)
+
+	renditions := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		// Never upscale beyond the source resolution
+		edge := size
+		if side < edge {
+			edge = side
 		}
-	}
-	return false
-}
-
-// convertHEIC converts HEIC images to JPEG using external tools
-func convertHEIC(data []byte) ([]byte, string, error) {
-	// Create temporary directories
-	tempDir, err := os.MkdirTemp("", "heic_conversion")
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
 
-	// Write HEIC data to temp file
-	heicPath := filepath.Join(tempDir, "input.heic")
-	if err := os.WriteFile(heicPath, data, 0644); err != nil {
-		return nil, "", fmt.Errorf("failed to write temp HEIC file: %w", err)
-	}
+		dst := image.NewRGBA(image.Rect(0, 0, edge, edge))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Over, nil)
 
-	// Define output JPEG path
-	jpegPath := filepath.Join(tempDir, "output.jpg")
-
-	// First try ImageMagick if available
-	cmd := exec.Command("convert", heicPath, jpegPath)
-	if err := cmd.Run(); err != nil {
-		// If ImageMagick fails, try libheif-tools (heif-convert)
-		cmd = exec.Command("heif-convert", "-q", "85", heicPath, jpegPath)
-		if err := cmd.Run(); err != nil {
-			// If external tools fail, try ffmpeg as a last resort
-			cmd = exec.Command("ffmpeg", "-i", heicPath, "-q:v", "2", jpegPath)
-			if err := cmd.Run(); err != nil {
-				return nil, "", fmt.Errorf("failed to convert HEIC to JPEG: %w", err)
-			}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: JpegQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode %dpx avatar: %w", size, err)
 		}
+		renditions[size] = buf.Bytes()
 	}
 
-	// Read the converted JPEG file
-	jpegData, err := os.ReadFile(jpegPath)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to read converted JPEG file: %w", err)
-	}
-
-	return jpegData, "image/jpeg", nil
+	return renditions, nil
 }
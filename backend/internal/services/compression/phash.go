@@ -0,0 +1,180 @@
+package compression
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Perceptual hashes are DCT hashes: the image is shrunk to hashSize square in
+// grayscale and each bit records whether one of the lowest hashFreq by
+// hashFreq frequencies is above their median. Resizing, recompression and
+// small edits change only a few bits.
+const (
+	hashSize = 32
+	hashFreq = 8
+)
+
+// Images with less contrast than this (standard deviation of 0-255 gray
+// levels) are too plain to identify, e.g. black video frames
+const minHashContrast = 4
+
+// Video frames need more contrast to be hashed, so that fades, near-black
+// frames and flat title backgrounds common to many videos are skipped
+const minFrameContrast = 16
+
+// MaxVideoHashes is the most keyframes hashed per video
+const MaxVideoHashes = 8
+
+// ImageHash returns the perceptual hash of an image. It reports false for
+// images too plain to hash usefully, which would match each other.
+func ImageHash(img image.Image) (uint64, bool) {
+	return imageHash(img, minHashContrast)
+}
+
+// imageHash returns the perceptual hash of an image with at least minContrast
+func imageHash(img image.Image, minContrast float64) (uint64, bool) {
+	small := image.NewGray(image.Rect(0, 0, hashSize, hashSize))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var pixels [hashSize][hashSize]float64
+	var sum, sumSquares float64
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			v := float64(small.Pix[y*small.Stride+x])
+			pixels[y][x] = v
+			sum += v
+			sumSquares += v * v
+		}
+	}
+	n := float64(hashSize * hashSize)
+	mean := sum / n
+	if math.Sqrt(sumSquares/n-mean*mean) < minContrast {
+		return 0, false
+	}
+
+	// Separable 2D DCT, keeping only the low frequencies
+	var rows [hashSize][hashFreq]float64
+	for y := 0; y < hashSize; y++ {
+		for u := 0; u < hashFreq; u++ {
+			rows[y][u] = dct(u, func(x int) float64 { return pixels[y][x] })
+		}
+	}
+	var coefficients [hashFreq * hashFreq]float64
+	for v := 0; v < hashFreq; v++ {
+		for u := 0; u < hashFreq; u++ {
+			coefficients[v*hashFreq+u] = dct(v, func(y int) float64 { return rows[y][u] })
+		}
+	}
+
+	// The first coefficient is the average brightness, which says nothing
+	// about the picture, so it is left out of the median
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, true
+}
+
+// dct returns frequency k of the unnormalized DCT-II of hashSize samples
+func dct(k int, sample func(int) float64) float64 {
+	var sum float64
+	for i := 0; i < hashSize; i++ {
+		sum += sample(i) * math.Cos(math.Pi*float64(k)*(2*float64(i)+1)/(2*hashSize))
+	}
+	return sum
+}
+
+// HashDistance returns the number of bits that differ between two hashes.
+// Copies of the same picture are usually within a handful of bits.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// ImageDataHash decodes an image, turns it upright and returns its perceptual
+// hash, reporting false if the image is too plain to hash
+func ImageDataHash(ctx context.Context, data []byte) (uint64, bool, error) {
+	img, _, err := DecodeImage(ctx, data)
+	if err != nil {
+		return 0, false, err
+	}
+	img = applyOrientation(img, readJPEGMetadata(data).orientation)
+	hash, ok := ImageHash(img)
+	return hash, ok, nil
+}
+
+// VideoHashes returns the perceptual hashes of up to MaxVideoHashes keyframes
+// spread across a video. Near-uniform frames are skipped and repeated hashes
+// are returned once.
+func VideoHashes(ctx context.Context, data []byte, fileName string) ([]uint64, error) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "video_hashes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create input file
+	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(fileName))
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write input file: %w", err)
+	}
+
+	// Sample evenly across the video; without a duration take the keyframes of
+	// the first few seconds
+	rate := "1"
+	if info, err := ProbeVideo(ctx, inputPath); err == nil && info.Duration > 0 {
+		rate = strconv.FormatFloat(MaxVideoHashes/info.Duration, 'f', 6, 64)
+	}
+
+	// Only keyframes are decoded, which is much faster than the whole video
+	args := []string{
+		"-skip_frame", "nokey",
+		"-i", inputPath,
+		"-an",
+		"-vf", "fps=" + rate + ",scale=64:64",
+		"-frames:v", strconv.Itoa(MaxVideoHashes),
+		filepath.Join(tempDir, "frame%02d.png"),
+	}
+	if err := runFFmpeg(ctx, args, nil); err != nil {
+		return nil, fmt.Errorf("keyframe extraction: %w", err)
+	}
+
+	var hashes []uint64
+	seen := make(map[uint64]bool)
+	for i := 1; i <= MaxVideoHashes; i++ {
+		file, err := os.Open(filepath.Join(tempDir, fmt.Sprintf("frame%02d.png", i)))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyframe: %w", err)
+		}
+		frame, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode keyframe: %w", err)
+		}
+
+		if hash, ok := imageHash(frame, minFrameContrast); ok && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
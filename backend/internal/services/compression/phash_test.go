@@ -0,0 +1,124 @@
+package compression
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestHashDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0xdeadbeef, 0xdeadbeef, 0},
+		{0, 1, 1},
+		{0b1010, 0b0101, 4},
+		{0, ^uint64(0), 64},
+		{1 << 63, 1, 2},
+	}
+
+	for _, tt := range tests {
+		if got := HashDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("HashDistance(%#x, %#x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// testPicture draws a few overlapping shapes, standing in for a photo
+func testPicture(size int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			v := uint8(x * 255 / size)
+			if x > size/4 && x < size/2 && y > size/3 {
+				v = 230
+			}
+			if (x-3*size/4)*(x-3*size/4)+(y-size/4)*(y-size/4) < size*size/36 {
+				v = 20
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+// uniform returns an image of a single gray level with noise of the given
+// amplitude in an 8px checkerboard
+func uniform(level, noise uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := level
+			if (x/8+y/8)%2 == 0 {
+				v += noise
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestImageHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		img         image.Image
+		minContrast float64
+		ok          bool
+	}{
+		{"picture", testPicture(256), minHashContrast, true},
+		{"black", uniform(0, 0), minHashContrast, false},
+		{"flat gray", uniform(128, 0), minHashContrast, false},
+		{"barely textured", uniform(128, 4), minHashContrast, false},
+		{"faint texture", uniform(128, 20), minHashContrast, true},
+		{"faint texture as a video frame", uniform(128, 20), minFrameContrast, false},
+		{"picture as a video frame", testPicture(256), minFrameContrast, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := imageHash(tt.img, tt.minContrast); ok != tt.ok {
+				t.Errorf("imageHash() ok = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestImageHashCopies(t *testing.T) {
+	original := testPicture(256)
+	hash, ok := ImageHash(original)
+	if !ok {
+		t.Fatal("ImageHash() of the original reported too plain")
+	}
+
+	// Resized copies of the same picture hash alike
+	for _, size := range []int{64, 100, 512} {
+		scaled := image.NewGray(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), original, original.Bounds(), draw.Src, nil)
+		copyHash, ok := ImageHash(scaled)
+		if !ok {
+			t.Fatalf("ImageHash() of the %dpx copy reported too plain", size)
+		}
+		if d := HashDistance(hash, copyHash); d > 6 {
+			t.Errorf("%dpx copy is %d bits from the original", size, d)
+		}
+	}
+
+	// A rotated copy is a different picture as far as the hash is concerned
+	rotated := image.NewGray(original.Bounds())
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			rotated.SetGray(x, y, original.GrayAt(y, 255-x))
+		}
+	}
+	otherHash, ok := ImageHash(rotated)
+	if !ok {
+		t.Fatal("ImageHash() of the rotated picture reported too plain")
+	}
+	if d := HashDistance(hash, otherHash); d <= 10 {
+		t.Errorf("rotated picture is only %d bits from the original", d)
+	}
+}
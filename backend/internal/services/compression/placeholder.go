@@ -0,0 +1,207 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Placeholder describes an image well enough for clients to lay it out and
+// paint something in its place before it loads
+type Placeholder struct {
+	Width         int
+	Height        int
+	BlurHash      string // See https://blurha.sh
+	DominantColor string // e.g. "#4a6b8c"
+}
+
+// Most blurhash components along the longer side; the shorter side gets fewer
+// so the blur keeps the image's proportions
+const blurHashComponents = 4
+
+// Placeholders are computed from a copy at most this wide or high, since
+// neither needs detail
+const placeholderSize = 64
+
+// ImagePlaceholder computes the placeholder of an image
+func ImagePlaceholder(img image.Image) Placeholder {
+	bounds := img.Bounds()
+	placeholder := Placeholder{Width: bounds.Dx(), Height: bounds.Dy()}
+	if bounds.Empty() {
+		return placeholder
+	}
+
+	// Shrink first, keeping the aspect ratio
+	w, h := placeholderSize, placeholderSize
+	if bounds.Dx() > bounds.Dy() {
+		h = max(1, placeholderSize*bounds.Dy()/bounds.Dx())
+	} else {
+		w = max(1, placeholderSize*bounds.Dx()/bounds.Dy())
+	}
+	small := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+
+	x, y := blurHashComponents, blurHashComponents
+	if w > h {
+		y = max(1, blurHashComponents*h/w)
+	} else {
+		x = max(1, blurHashComponents*w/h)
+	}
+	placeholder.BlurHash = blurHash(small, x, y)
+	placeholder.DominantColor = dominantColor(small)
+	return placeholder
+}
+
+// ThumbnailPlaceholder computes the placeholder of a JPEG video thumbnail
+func ThumbnailPlaceholder(data []byte) (Placeholder, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Placeholder{}, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	return ImagePlaceholder(img), nil
+}
+
+// dominantColor returns the most common color of an image, grouping similar
+// colors together. Transparent pixels are ignored.
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct{ count, r, g, b int }
+	var buckets [4096]bucket
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			r, g, b, a := int(row[4*x]), int(row[4*x+1]), int(row[4*x+2]), row[4*x+3]
+			if a < 128 {
+				continue
+			}
+			// 4 bits per channel
+			bk := &buckets[(r>>4)<<8|(g>>4)<<4|b>>4]
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+		}
+	}
+
+	best := &buckets[0]
+	for i := range buckets {
+		if buckets[i].count > best.count {
+			best = &buckets[i]
+		}
+	}
+	if best.count == 0 {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// blurHash encodes an image with x by y components
+func blurHash(img *image.NRGBA, x, y int) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	// Linear light values, computed once
+	linear := make([][3]float64, width*height)
+	for py := 0; py < height; py++ {
+		row := img.Pix[py*img.Stride:]
+		for px := 0; px < width; px++ {
+			for c := 0; c < 3; c++ {
+				linear[py*width+px][c] = sRGBToLinear(row[4*px+c])
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, x*y)
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			var factor [3]float64
+			for py := 0; py < height; py++ {
+				for px := 0; px < width; px++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(px)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(py)/float64(height))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * linear[py*width+px][c]
+					}
+				}
+			}
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			scale := normalisation / float64(width*height)
+			for c := 0; c < 3; c++ {
+				factor[c] *= scale
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((x-1)+(y-1)*9, 1))
+
+	// The AC components are quantized relative to the largest of them
+	maxValue := 1.0
+	if len(factors) > 1 {
+		var actualMax float64
+		for _, factor := range factors[1:] {
+			for _, v := range factor {
+				actualMax = math.Max(actualMax, math.Abs(v))
+			}
+		}
+		quantisedMax := clamp(int(math.Floor(actualMax*166-0.5)), 0, 82)
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		var quantised [3]int
+		for c, v := range factor {
+			quantised[c] = clamp(int(math.Floor(signPow(v/maxValue, 0.5)*9+9.5)), 0, 18)
+		}
+		hash.WriteString(encode83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2))
+	}
+	return hash.String()
+}
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encode83 writes value as length base 83 digits
+func encode83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(high, value))
+}
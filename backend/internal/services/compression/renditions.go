@@ -0,0 +1,208 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// RenditionWidths are the widths (in pixels) each image is resized to for
+// responsive loading. Widths larger than the image are skipped and the image's
+// own width is always included.
+var RenditionWidths = []int{320, 640, 1080, 1920}
+
+// Quality settings for the modern formats, roughly matching JpegQuality
+const (
+	webpQuality = 80
+	avifCRF     = 32
+)
+
+// ImageRendition is one encoded size and format of an image
+type ImageRendition struct {
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Extension returns the file extension for the rendition's format
+func (r ImageRendition) Extension() string {
+	switch r.ContentType {
+	case "image/webp":
+		return ".webp"
+	case "image/avif":
+		return ".avif"
+	case "image/png":
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// modernFormat is an image format encoded by ffmpeg, used only if the
+// installed ffmpeg has the encoder
+type modernFormat struct {
+	contentType string
+	encoder     string
+	ext         string
+	args        []string
+}
+
+var modernFormats = []modernFormat{
+	{"image/avif", "libaom-av1", ".avif", []string{"-still-picture", "1", "-crf", strconv.Itoa(avifCRF), "-cpu-used", "6", "-pix_fmt", "yuv420p"}},
+	{"image/webp", "libwebp", ".webp", []string{"-quality", strconv.Itoa(webpQuality)}},
+}
+
+var (
+	ffmpegEncodersOnce sync.Once
+	ffmpegEncoders     string
+)
+
+// hasEncoder reports whether the installed ffmpeg supports an encoder. The
+// encoder list is read once.
+func hasEncoder(name string) bool {
+	ffmpegEncodersOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+		output, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-encoders").Output()
+		if err != nil {
+			log.Printf("Warning: Could not list ffmpeg encoders, WebP and AVIF renditions are disabled: %v", err)
+			return
+		}
+		ffmpegEncoders = string(output)
+	})
+	for _, line := range strings.Split(ffmpegEncoders, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// renditionSizes returns the widths and heights to produce for an image
+func renditionSizes(bounds image.Rectangle) []image.Point {
+	width, height := bounds.Dx(), bounds.Dy()
+	var sizes []image.Point
+	for _, w := range RenditionWidths {
+		if w >= width {
+			break
+		}
+		h := (w*height + width/2) / width
+		if h < 1 {
+			h = 1
+		}
+		sizes = append(sizes, image.Pt(w, h))
+	}
+	return append(sizes, image.Pt(width, height))
+}
+
+// CreateImageRenditions encodes an image at each of RenditionWidths. Every size
+// gets a fallback rendition in contentType (JPEG or PNG), plus AVIF and WebP
+// renditions when ffmpeg can encode them. A modern format that fails is logged
+// and skipped, since the fallback is always usable.
+func CreateImageRenditions(ctx context.Context, img image.Image, contentType string) ([]ImageRendition, error) {
+	sizes := renditionSizes(img.Bounds())
+	var renditions []ImageRendition
+
+	// Fallback renditions, encoded in Go
+	for _, size := range sizes {
+		scaled := image.Image(img)
+		if size != img.Bounds().Size() {
+			dst := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+			draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+			scaled = dst
+		}
+
+		data, fallbackType, err := encodeImage(scaled, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %dpx rendition: %w", size.X, err)
+		}
+		renditions = append(renditions, ImageRendition{Width: size.X, Height: size.Y, ContentType: fallbackType, Data: data})
+	}
+
+	for _, format := range modernFormats {
+		if !hasEncoder(format.encoder) {
+			continue
+		}
+		encoded, err := encodeWithFFmpeg(ctx, img, sizes, format)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to create %s renditions: %v", format.contentType, err)
+			continue
+		}
+		renditions = append(renditions, encoded...)
+	}
+
+	return renditions, nil
+}
+
+// encodeImage encodes an image as PNG if contentType is PNG, and as JPEG
+// otherwise. It returns the content type actually used.
+func encodeImage(img image.Image, contentType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JpegQuality}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// encodeWithFFmpeg encodes every size of an image in one ffmpeg run
+func encodeWithFFmpeg(ctx context.Context, img image.Image, sizes []image.Point, format modernFormat) ([]ImageRendition, error) {
+	// Create temporary directory
+	tempDir, err := os.MkdirTemp("", "image_renditions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Lossless input, so the image is only compressed once
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	inputPath := filepath.Join(tempDir, "input.png")
+	if err := os.WriteFile(inputPath, input.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write input file: %w", err)
+	}
+
+	args := []string{"-i", inputPath}
+	for _, size := range sizes {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d:flags=lanczos", size.X, size.Y), "-c:v", format.encoder)
+		args = append(args, format.args...)
+		args = append(args, filepath.Join(tempDir, strconv.Itoa(size.X)+format.ext))
+	}
+
+	if err := runFFmpeg(ctx, args, nil); err != nil {
+		return nil, fmt.Errorf("%s renditions: %w", format.encoder, err)
+	}
+
+	renditions := make([]ImageRendition, 0, len(sizes))
+	for _, size := range sizes {
+		data, err := os.ReadFile(filepath.Join(tempDir, strconv.Itoa(size.X)+format.ext))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %dpx rendition: %w", size.X, err)
+		}
+		renditions = append(renditions, ImageRendition{Width: size.X, Height: size.Y, ContentType: format.contentType, Data: data})
+	}
+	return renditions, nil
+}
@@ -1,17 +1,18 @@
 package compression
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 // CompressVideo compresses a video to reduce file size using FFmpeg
 // Also handles format conversion for wider compatibility
-func CompressVideo(data []byte, contentType string) ([]byte, string, error) {
+func CompressVideo(ctx context.Context, data []byte, contentType string) ([]byte, string, error) {
 	// Create temporary directory
 	tempDir, err := os.MkdirTemp("", "video_compression")
 	if err != nil {
@@ -45,9 +46,14 @@ func CompressVideo(data []byte, contentType string) ([]byte, string, error) {
 	// Create output file (always MP4 for best compatibility)
 	outputPath := filepath.Join(tempDir, uuid.New().String()+".mp4")
 
+	// The duration is only needed to log progress
+	var progress func(Progress)
+	if info, err := ProbeVideo(ctx, inputPath); err == nil {
+		progress = logProgress("Video compression", time.Duration(info.Duration*float64(time.Second)))
+	}
+
 	// Compress and convert video using FFmpeg
-	cmd := exec.Command(
-		"ffmpeg",
+	args := []string{
 		"-i", inputPath,
 		"-c:v", "libx264",
 		"-crf", "23",
@@ -57,11 +63,11 @@ func CompressVideo(data []byte, contentType string) ([]byte, string, error) {
 		"-movflags", "+faststart",
 		"-vf", "scale=trunc(min(1920,iw)/2)*2:trunc(min(1080,ih)/2)*2",
 		outputPath,
-	)
+	}
 
 	// Run compression
-	if err := cmd.Run(); err != nil {
-		return nil, "", fmt.Errorf("ffmpeg compression failed: %w", err)
+	if err := runFFmpeg(ctx, args, progress); err != nil {
+		return nil, "", fmt.Errorf("video compression: %w", err)
 	}
 
 	// Read compressed file
@@ -84,3 +90,34 @@ func CheckVideoCompatibility(fileData []byte, contentType string) bool {
 	// For other formats, we need to convert them
 	return false
 }
+
+// ExtractThumbnail grabs the frame one second into a video as a JPEG
+func ExtractThumbnail(ctx context.Context, data []byte, fileName string) ([]byte, error) {
+	// Create temporary directory for processing
+	tempDir, err := os.MkdirTemp("", "video_thumbnail")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Write video file to temp directory
+	inputPath := filepath.Join(tempDir, "input"+filepath.Ext(fileName))
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	// Generate thumbnail
+	thumbnailPath := filepath.Join(tempDir, "thumbnail.jpg")
+	args := []string{
+		"-i", inputPath,
+		"-ss", "00:00:01", // Extract frame at 1 second
+		"-vframes", "1",
+		"-f", "image2",
+		thumbnailPath,
+	}
+	if err := runFFmpeg(ctx, args, nil); err != nil {
+		return nil, fmt.Errorf("thumbnail extraction: %w", err)
+	}
+
+	return os.ReadFile(thumbnailPath)
+}
@@ -0,0 +1,121 @@
+// Package entities finds @mentions and #hashtags in captions and comments
+package entities
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"backend/internal/models"
+)
+
+// Longest username and hashtag recognized, in characters
+const (
+	MaxUsernameLength = 255
+	MaxHashtagLength  = 100
+)
+
+// Parse finds the mentions and hashtags in text, in order. Mentions are not
+// checked against existing users. A mention or hashtag must start the text or
+// follow a character that can't be part of a word, so e-mail addresses and
+// URL fragments aren't matched.
+func Parse(text string) models.Entities {
+	var found models.Entities
+	offset := 0 // In UTF-16 code units
+	prev := ' '
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if (r == '@' || r == '#') && !isWordRune(prev) && prev != '@' && prev != '#' {
+			var name string
+			if r == '@' {
+				name = scanUsername(text[i+size:])
+			} else {
+				name = scanHashtag(text[i+size:])
+			}
+			if name != "" {
+				entity := models.Entity{Type: models.EntityMention, Start: offset, Text: name}
+				if r == '#' {
+					entity.Type = models.EntityHashtag
+					entity.Text = strings.ToLower(name)
+				}
+				entity.End = offset + 1 + utf16Len(name)
+				found = append(found, entity)
+
+				// Continue after the entity
+				i += size + len(name)
+				offset = entity.End
+				prev, _ = utf8.DecodeLastRuneInString(name)
+				continue
+			}
+		}
+		i += size
+		offset += utf16.RuneLen(r)
+		prev = r
+	}
+	return found
+}
+
+// NormalizeHashtag returns tag in the form hashtags are stored, without a
+// leading # and in lowercase. It returns "" if tag isn't a valid hashtag.
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimPrefix(tag, "#")
+	if scanHashtag(tag) != tag {
+		return ""
+	}
+	return strings.ToLower(tag)
+}
+
+// scanUsername returns the username at the start of s. Usernames are ASCII
+// letters, digits, underscores and dots, but can't end with a dot, so a
+// mention may end a sentence.
+func scanUsername(s string) string {
+	end := 0
+	for end < len(s) && end < MaxUsernameLength {
+		c := s[end]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			break
+		}
+		end++
+	}
+	return strings.TrimRight(s[:end], ".")
+}
+
+// scanHashtag returns the hashtag at the start of s. Hashtags are letters,
+// digits and underscores in any script, and must contain a letter so that
+// e.g. "#1" isn't one.
+func scanHashtag(s string) string {
+	end, length := 0, 0
+	hasLetter := false
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(r) && !unicode.Is(unicode.Mn, r) {
+			break
+		}
+		if length == MaxHashtagLength {
+			// Too long to be a tag
+			return ""
+		}
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		end += size
+		length++
+	}
+	if !hasLetter {
+		return ""
+	}
+	return s[:end]
+}
+
+// isWordRune reports whether r can be part of a username or hashtag
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
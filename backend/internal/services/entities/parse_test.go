@@ -0,0 +1,85 @@
+package entities
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func mention(start, end int, text string) models.Entity {
+	return models.Entity{Type: models.EntityMention, Start: start, End: end, Text: text}
+}
+
+func hashtag(start, end int, text string) models.Entity {
+	return models.Entity{Type: models.EntityHashtag, Start: start, End: end, Text: text}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want models.Entities
+	}{
+		{"empty", "", nil},
+		{"plain text", "no entities here", nil},
+		{"mention", "hi @alice", models.Entities{mention(3, 9, "alice")}},
+		{"hashtag is lowercased", "#GoLang", models.Entities{hashtag(0, 7, "golang")}},
+		{"mention and hashtag", "@bob loves #cats", models.Entities{mention(0, 4, "bob"), hashtag(11, 16, "cats")}},
+		{"trailing dot ends mention", "thanks @bob.", models.Entities{mention(7, 11, "bob")}},
+		{"dot inside username", "@first.last!", models.Entities{mention(0, 11, "first.last")}},
+		{"e-mail address", "mail me at bob@example.com", nil},
+		{"url fragment", "see example.com/page#section", nil},
+		{"repeated marker", "@@bob ##tag", nil},
+		{"adjacent entities", "#a#b @c@d", models.Entities{hashtag(0, 2, "a"), mention(5, 7, "c")}},
+		{"hashtag without letters", "#1 #2024", nil},
+		{"hashtag with digits", "#2024goals", models.Entities{hashtag(0, 10, "2024goals")}},
+		{"bare markers", "@ # @. #_", nil},
+		{"non-ascii hashtag", "#café", models.Entities{hashtag(0, 5, "café")}},
+		{"combining mark in hashtag", "#cafe\u0301", models.Entities{hashtag(0, 6, "cafe\u0301")}},
+		{"non-ascii username stops", "@bö", models.Entities{mention(0, 2, "b")}},
+		// Offsets are in UTF-16 code units, so the emoji counts twice
+		{"offsets after emoji", "😀 @bob #tag", models.Entities{mention(3, 7, "bob"), hashtag(8, 12, "tag")}},
+		{"offsets after accented letter", "é @bob", models.Entities{mention(2, 6, "bob")}},
+		{"hashtag with astral letter", "#𝒜b", models.Entities{hashtag(0, 4, "𝒜b")}},
+		{"too long hashtag", "#" + strings.Repeat("a", MaxHashtagLength+1), nil},
+		{"longest hashtag", "#" + strings.Repeat("a", MaxHashtagLength), models.Entities{
+			hashtag(0, MaxHashtagLength+1, strings.Repeat("a", MaxHashtagLength)),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"golang", "golang"},
+		{"#GoLang", "golang"},
+		{"Café", "café"},
+		{"snake_case", "snake_case"},
+		{"", ""},
+		{"#", ""},
+		{"123", ""},
+		{"two words", ""},
+		{"##tag", ""},
+		{"tag!", ""},
+		{strings.Repeat("a", MaxHashtagLength+1), ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeHashtag(tt.tag); got != tt.want {
+			t.Errorf("NormalizeHashtag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+const (
+	// How long a worker sleeps when the queue is empty
+	pollInterval = 2 * time.Second
+	// Longest a single job may run before its context is cancelled, unless
+	// its kind was registered with another limit
+	defaultJobTimeout = 20 * time.Minute
+	// Running jobs locked for this much longer than their kind's timeout are
+	// assumed to belong to a crashed worker and are picked up again
+	lockGrace = 5 * time.Minute
+	// Number of attempts a job gets unless enqueued with another limit
+	defaultMaxAttempts = 3
+)
+
+// errAbandoned is recorded for jobs whose worker stopped on their last attempt
+var errAbandoned = errors.New("worker stopped while running the job on its last attempt")
+
+// Job is a unit of background work stored in the jobs table
+type Job struct {
+	ID          string         `db:"id"`
+	Kind        string         `db:"kind"`
+	Payload     types.JSONText `db:"payload"`
+	Status      string         `db:"status"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	LastError   sql.NullString `db:"last_error"`
+	RunAt       time.Time      `db:"run_at"`
+	LockedAt    *time.Time     `db:"locked_at"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+}
+
+// RunFunc performs a job. Returning an error retries the job with backoff
+// until it runs out of attempts; wrap the error with Permanent to fail at once.
+type RunFunc func(ctx context.Context, job *Job) error
+
+// FailFunc is called once a job has failed for the last time
+type FailFunc func(ctx context.Context, job *Job, err error)
+
+type handler struct {
+	run     RunFunc
+	failed  FailFunc
+	timeout time.Duration
+}
+
+// permanentError marks an error that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails without further attempts
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Execer is satisfied by both *sqlx.DB and *sqlx.Tx, so jobs can be enqueued
+// in the same transaction as the rows they work on
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue adds a job of the given kind. The payload is stored as JSON.
+func Enqueue(db Execer, kind string, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	id := uuid.New().String()
+	now := time.Now()
+	_, err = db.Exec(
+		`INSERT INTO jobs (id, kind, payload, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 0, $5, $6, $6, $6)`,
+		id, kind, types.JSONText(data), StatusPending, defaultMaxAttempts, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+
+	return id, nil
+}
+
+// Queue runs jobs from the jobs table on a pool of worker goroutines. Several
+// API processes may share the table; SKIP LOCKED keeps them from claiming
+// the same job.
+type Queue struct {
+	db          *sqlx.DB
+	handlers    map[string]handler
+	lockTimeout time.Duration // Of the longest running kind
+	wg          sync.WaitGroup
+}
+
+// NewQueue creates a queue with no registered job kinds
+func NewQueue(db *sqlx.DB) *Queue {
+	return &Queue{
+		db:       db,
+		handlers: make(map[string]handler),
+	}
+}
+
+// Register sets the functions that run and finally fail jobs of a kind, and
+// the longest a job of the kind may run, or 0 for the default. It must be
+// called before Start.
+func (q *Queue) Register(kind string, run RunFunc, failed FailFunc, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultJobTimeout
+	}
+	q.handlers[kind] = handler{run: run, failed: failed, timeout: timeout}
+	if timeout+lockGrace > q.lockTimeout {
+		q.lockTimeout = timeout + lockGrace
+	}
+}
+
+// Start launches workers that poll for jobs until ctx is cancelled
+func (q *Queue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	log.Printf("Started %d job workers", workers)
+}
+
+// Wait blocks until every worker has stopped
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to claim job: %v", err)
+		}
+
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+
+		// Fail abandoned jobs that have no attempts left while otherwise idle
+		q.failAbandoned()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// claim locks the next runnable job, including jobs abandoned by a worker
+// that stopped mid-run if they have attempts left
+func (q *Queue) claim() (*Job, error) {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var job Job
+	err := q.db.Get(&job, `
+		UPDATE jobs SET status = $1, attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE kind = ANY($2) AND (
+				(status = $3 AND run_at <= NOW()) OR
+				(status = $1 AND locked_at < NOW() - $4 * INTERVAL '1 second' AND attempts < max_attempts)
+			)
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusRunning, pq.Array(kinds), StatusPending, int(q.lockTimeout.Seconds()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// failAbandoned marks jobs failed whose worker stopped mid-run on their last
+// attempt, such as jobs that crash or hang the process every time they run,
+// and calls their kind's failure function
+func (q *Queue) failAbandoned() {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var abandoned []Job
+	err := q.db.Select(&abandoned, `
+		UPDATE jobs SET status = $1, last_error = $2, locked_at = NULL, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind = ANY($3) AND status = $4
+				AND locked_at < NOW() - $5 * INTERVAL '1 second' AND attempts >= max_attempts
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusFailed, errAbandoned.Error(), pq.Array(kinds), StatusRunning, int(q.lockTimeout.Seconds()),
+	)
+	if err != nil {
+		log.Printf("Failed to fail abandoned jobs: %v", err)
+		return
+	}
+
+	for i := range abandoned {
+		job := &abandoned[i]
+		log.Printf("Job %s (%s) failed: %v", job.ID, job.Kind, errAbandoned)
+		if h := q.handlers[job.Kind]; h.failed != nil {
+			h.failed(context.Background(), job, errAbandoned)
+		}
+	}
+}
+
+// run executes a claimed job and records the outcome
+func (q *Queue) run(ctx context.Context, job *Job) {
+	h := q.handlers[job.Kind]
+
+	jobCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	err := h.run(jobCtx, job)
+	timedOut := jobCtx.Err() == context.DeadlineExceeded
+	cancel()
+
+	// A job interrupted by shutdown is released without using up an attempt
+	if err != nil && ctx.Err() != nil {
+		_, dbErr := q.db.Exec(
+			"UPDATE jobs SET status = $1, attempts = attempts - 1, locked_at = NULL, updated_at = NOW() WHERE id = $2",
+			StatusPending, job.ID,
+		)
+		if dbErr != nil {
+			log.Printf("Failed to release job %s: %v", job.ID, dbErr)
+		}
+		return
+	}
+
+	// A job that used up its whole time would do so again
+	if err != nil && timedOut {
+		err = Permanent(fmt.Errorf("job ran longer than %s: %w", h.timeout, err))
+	}
+
+	if err == nil {
+		_, err = q.db.Exec(
+			"UPDATE jobs SET status = $1, last_error = NULL, locked_at = NULL, updated_at = NOW() WHERE id = $2",
+			StatusDone, job.ID,
+		)
+		if err != nil {
+			log.Printf("Failed to mark job %s done: %v", job.ID, err)
+		}
+		return
+	}
+
+	if job.Attempts < job.MaxAttempts && !IsPermanent(err) {
+		// Retry with exponential backoff: 30s, 1m, 2m, ...
+		backoff := time.Duration(1<<uint(job.Attempts-1)) * 30 * time.Second
+		log.Printf("Job %s (%s) failed on attempt %d, retrying in %s: %v", job.ID, job.Kind, job.Attempts, backoff, err)
+		_, dbErr := q.db.Exec(
+			"UPDATE jobs SET status = $1, last_error = $2, locked_at = NULL, run_at = $3, updated_at = NOW() WHERE id = $4",
+			StatusPending, err.Error(), time.Now().Add(backoff), job.ID,
+		)
+		if dbErr != nil {
+			log.Printf("Failed to reschedule job %s: %v", job.ID, dbErr)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) failed: %v", job.ID, job.Kind, err)
+	_, dbErr := q.db.Exec(
+		"UPDATE jobs SET status = $1, last_error = $2, locked_at = NULL, updated_at = NOW() WHERE id = $3",
+		StatusFailed, err.Error(), job.ID,
+	)
+	if dbErr != nil {
+		log.Printf("Failed to mark job %s failed: %v", job.ID, dbErr)
+	}
+	if h.failed != nil {
+		h.failed(context.Background(), job, err)
+	}
+}
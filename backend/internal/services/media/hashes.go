@@ -0,0 +1,114 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/services/compression"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrDuplicateMedia is returned for uploads that closely match media the
+	// user has already posted
+	ErrDuplicateMedia = errors.New("duplicate media")
+
+	// ErrBlockedMedia is returned for uploads that closely match media taken
+	// down by a moderator
+	ErrBlockedMedia = errors.New("blocked media")
+)
+
+// HashImage returns the perceptual hash of an image, or none if it is too
+// plain to identify. Videos are only hashed by the worker, since extracting
+// their keyframes needs ffmpeg.
+func HashImage(ctx context.Context, data []byte) ([]uint64, error) {
+	hash, ok, err := compression.ImageDataHash(ctx, data)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []uint64{hash}, nil
+}
+
+// CheckHashes rejects media whose hashes are within the configured distance of
+// a blocked item or of media the user has already posted. Failed and removed
+// posts don't count as already posted.
+func (v *Validator) CheckHashes(q sqlx.Queryer, userID string, hashes []uint64) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	// The blocklist is small enough to compare in full. Hashes blocked along
+	// with a post are compared as one item; ones blocked by hand stand alone.
+	var blocked []itemHash
+	if err := sqlx.Select(q, &blocked, "SELECT COALESCE(post_id, id) AS item, hash FROM blocked_hashes"); err != nil {
+		return fmt.Errorf("failed to get blocked hashes: %w", err)
+	}
+	if v.matchesItem(hashes, blocked) {
+		return &ValidationError{
+			Err:     ErrBlockedMedia,
+			Message: "This media was removed by a moderator and can't be posted again",
+		}
+	}
+
+	var posted []itemHash
+	err := sqlx.Select(q, &posted,
+		`SELECT mh.post_id || '/' || mh.position AS item, mh.hash
+		FROM media_hashes mh
+		JOIN posts p ON p.id = mh.post_id
+		WHERE p.user_id = $1 AND p.status IN ($2, $3)`,
+		userID, models.PostStatusReady, models.PostStatusProcessing,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get posted hashes: %w", err)
+	}
+	if v.matchesItem(hashes, posted) {
+		return &ValidationError{
+			Err:     ErrDuplicateMedia,
+			Message: "You have already posted this",
+		}
+	}
+	return nil
+}
+
+// itemHash is one stored hash of a known media item
+type itemHash struct {
+	Item string `db:"item"`
+	Hash int64  `db:"hash"`
+}
+
+// matchesItem reports whether most of hashes are close to a hash of the same
+// known item. Unrelated videos can share a black frame, a title card or a
+// scene, so a single matching keyframe isn't enough; an image has only one
+// hash, which must match.
+func (v *Validator) matchesItem(hashes []uint64, known []itemHash) bool {
+	items := make(map[string][]int64)
+	for _, k := range known {
+		items[k.Item] = append(items[k.Item], k.Hash)
+	}
+
+	for _, itemHashes := range items {
+		matched := 0
+		for _, hash := range hashes {
+			if v.matchesAny(hash, itemHashes) {
+				matched++
+			}
+		}
+		if matched*2 > len(hashes) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether hash is close to any of known
+func (v *Validator) matchesAny(hash uint64, known []int64) bool {
+	for _, k := range known {
+		if compression.HashDistance(hash, uint64(k)) <= v.config.MatchDistance {
+			return true
+		}
+	}
+	return false
+}
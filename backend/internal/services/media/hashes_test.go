@@ -0,0 +1,58 @@
+package media
+
+import (
+	"testing"
+
+	"backend/configs"
+)
+
+func TestMatchesItem(t *testing.T) {
+	v := NewValidator(configs.MediaConfig{MatchDistance: 4})
+
+	tests := []struct {
+		name   string
+		hashes []uint64
+		known  []itemHash
+		want   bool
+	}{
+		{"nothing known", []uint64{0xff}, nil, false},
+		{"image matches exactly", []uint64{0xff}, []itemHash{{"a", 0xff}}, true},
+		{"image within distance", []uint64{0xff}, []itemHash{{"a", 0x0f}}, true},
+		{"image too far", []uint64{0xff}, []itemHash{{"a", 0x07}}, false},
+		{"image matches second item", []uint64{0xff}, []itemHash{{"a", 0}, {"b", 0xfe}}, true},
+		{
+			"most video frames match one item",
+			[]uint64{0x1, 0x2, 0x4},
+			[]itemHash{{"a", 0x1}, {"a", 0x2}, {"a", -1}},
+			true,
+		},
+		{
+			"single shared video frame",
+			[]uint64{0x1, 0xff00, 0xff0000},
+			[]itemHash{{"a", 0x1}, {"a", -1}},
+			false,
+		},
+		{
+			// Half isn't most
+			"half the video frames match",
+			[]uint64{0x1, 0xff00},
+			[]itemHash{{"a", 0x1}},
+			false,
+		},
+		{
+			// Frames matching different items don't add up
+			"frames split across items",
+			[]uint64{0x1, 0xff00, 0xff0000},
+			[]itemHash{{"a", 0x1}, {"b", 0xff00}},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.matchesItem(tt.hashes, tt.known); got != tt.want {
+				t.Errorf("matchesItem() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
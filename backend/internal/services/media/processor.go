@@ -0,0 +1,535 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/configs"
+	"backend/internal/models"
+	"backend/internal/services/compression"
+	"backend/internal/services/jobs"
+	"backend/internal/services/notifications"
+	"backend/internal/storage"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ProcessPostJob is the job kind that turns staged uploads into a post's media
+const ProcessPostJob = "process_post_media"
+
+// ProcessPostPayload describes a post's staged uploads waiting to be processed
+type ProcessPostPayload struct {
+	PostID string       `json:"postId"`
+	Items  []StagedItem `json:"items"`
+
+	// Single upload written by jobs queued before posts could hold several items
+	UploadKey   string `json:"uploadKey,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// StagedItem is one staged upload of a post, in display order
+type StagedItem struct {
+	UploadKey   string `json:"uploadKey"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType,omitempty"` // As declared; the worker detects the real type from the content
+}
+
+// items returns the payload's uploads, including a legacy single upload
+func (p ProcessPostPayload) items() []StagedItem {
+	if len(p.Items) == 0 && p.UploadKey != "" {
+		return []StagedItem{{UploadKey: p.UploadKey, FileName: p.FileName, ContentType: p.ContentType}}
+	}
+	return p.Items
+}
+
+// Processor compresses staged uploads and promotes them to post media
+type Processor struct {
+	db        *sqlx.DB
+	blob      storage.Blob
+	config    configs.MediaConfig
+	validator *Validator
+}
+
+// NewProcessor creates a new media processor
+func NewProcessor(db *sqlx.DB, blob storage.Blob, config configs.MediaConfig) *Processor {
+	return &Processor{
+		db:        db,
+		blob:      blob,
+		config:    config,
+		validator: NewValidator(config),
+	}
+}
+
+// Register adds the processor's job kinds to a queue. A post job may take as
+// long as its largest allowed carousel, plus time for storage transfers.
+func (p *Processor) Register(queue *jobs.Queue) {
+	timeout := time.Duration(models.MaxPostMedia)*p.itemTimeout() + jobStorageTime
+	queue.Register(ProcessPostJob, p.ProcessPost, p.PostFailed, timeout)
+}
+
+// Time allowed per post job for uploads and downloads, on top of the items'
+// processing time
+const jobStorageTime = 10 * time.Minute
+
+// itemTimeout returns how long processing one media item may take: every tool
+// run a video needs at the per-run timeout, which leaves time for waiting on
+// a transcode slot between them
+func (p *Processor) itemTimeout() time.Duration {
+	return time.Duration(compression.VideoToolRuns()) * p.config.TranscodeTimeout
+}
+
+// ProcessPost pulls a post's staged uploads, validates and compresses them,
+// stores the results under their permanent keys and marks the post ready
+func (p *Processor) ProcessPost(ctx context.Context, job *jobs.Job) error {
+	var payload ProcessPostPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	items := payload.items()
+	if len(items) == 0 {
+		return jobs.Permanent(errors.New("no media to process"))
+	}
+
+	// The post may have been deleted while the job was queued
+	var post models.Post
+	err := p.db.Get(&post, "SELECT id, user_id, status FROM posts WHERE id = $1", payload.PostID)
+	if err == sql.ErrNoRows || (err == nil && post.Status != models.PostStatusProcessing) {
+		p.deleteStaged(items)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+
+	// Everything uploaded so far is removed again if the post can't be completed.
+	// HLS streams and image renditions are kept together under per-post prefixes.
+	var uploaded []string
+	cleanup := func() {
+		p.deleteObjects(uploaded)
+		p.deletePrefix(HLSPrefix(payload.PostID))
+		p.deletePrefix(RenditionsPrefix(payload.PostID))
+	}
+
+	media := make([]models.PostMedia, len(items))
+	for i, item := range items {
+		// Each item has its own time limit, so one slow video is reported as
+		// such rather than using up the whole job
+		itemCtx, cancel := context.WithTimeout(ctx, p.itemTimeout())
+		processed, keys, err := p.processItem(itemCtx, post, i, item)
+		if err != nil && itemCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = jobs.Permanent(errors.New("the media took too long to process, please upload a shorter video"))
+		}
+		cancel()
+		uploaded = append(uploaded, keys...)
+		if err != nil {
+			cleanup()
+			if jobs.IsPermanent(err) && len(items) > 1 {
+				return jobs.Permanent(fmt.Errorf("item %d: %w", i+1, err))
+			}
+			return err
+		}
+		media[i] = processed
+	}
+
+	if err := p.completePost(post, media); err != nil {
+		cleanup()
+		if err == sql.ErrNoRows {
+			// Deleted while processing
+			p.deleteStaged(items)
+			return nil
+		}
+		return err
+	}
+
+	p.deleteStaged(items)
+	return nil
+}
+
+// processItem compresses one staged upload and stores the results under their
+// permanent keys. Uploads matching blocked media or the owner's earlier posts
+// are rejected before anything is stored. The uploaded keys are returned even
+// on failure so the caller can remove them.
+func (p *Processor) processItem(ctx context.Context, post models.Post, position int, item StagedItem) (models.PostMedia, []string, error) {
+	result := models.PostMedia{Position: position}
+
+	// Pull the staged file from storage
+	fileData, _, err := p.blob.Download(ctx, item.UploadKey, p.validator.MaxBytes())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return result, nil, jobs.Permanent(errors.New("upload not found"))
+		}
+		if errors.Is(err, storage.ErrTooLarge) {
+			return result, nil, jobs.Permanent(errors.New("file is too large"))
+		}
+		return result, nil, err
+	}
+
+	// Direct uploads reach storage unchecked, so the content decides the type
+	// and limits are enforced here as well as in CreatePost
+	contentType, err := p.validator.Validate(ctx, fileData, item.FileName)
+	if err != nil {
+		return result, nil, jobs.Permanent(err)
+	}
+
+	// Determine media type (image or video)
+	var thumbnailData []byte
+	var hlsFiles map[string][]byte
+	var renditions []compression.ImageRendition
+	switch {
+	case strings.HasPrefix(contentType, "video/"):
+		result.MediaType = "video"
+
+		// Check for copies before the expensive transcoding
+		result.Hashes, err = compression.VideoHashes(ctx, fileData, item.FileName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, nil, ctx.Err()
+			}
+			// Log error but continue unchecked
+			log.Printf("Failed to hash video keyframes: %v", err)
+		}
+		if err := p.checkHashes(post.UserID, result.Hashes); err != nil {
+			return result, nil, err
+		}
+
+		// Renditions are encoded from the original upload rather than the
+		// MP4 fallback, to avoid compressing twice
+		if p.config.HLS {
+			hlsFiles, err = compression.CreateHLS(ctx, fileData, item.FileName)
+			if err != nil {
+				// Log error but continue with only the MP4
+				log.Printf("Failed to create HLS renditions: %v", err)
+			}
+		}
+
+		// Handle iOS video formats like MOV
+		if contentType == "video/quicktime" || contentType == "video/mov" || !compression.CheckVideoCompatibility(fileData, contentType) {
+			// Convert to MP4
+			fileData, contentType, err = compression.CompressVideo(ctx, fileData, contentType)
+			if err != nil {
+				log.Printf("ProcessPost: %v", err)
+				if errors.Is(err, compression.ErrTimeout) {
+					return result, nil, jobs.Permanent(errors.New("the video took too long to process, please upload a shorter video"))
+				}
+				return result, nil, jobs.Permanent(errors.New("failed to convert video format, please use MP4 or WebM"))
+			}
+		}
+
+		thumbnailData, err = compression.ExtractThumbnail(ctx, fileData, item.FileName)
+		if err != nil {
+			// Log error but continue without a thumbnail
+			log.Printf("Failed to generate thumbnail: %v", err)
+		} else if placeholder, err := compression.ThumbnailPlaceholder(thumbnailData); err != nil {
+			// Log error but continue without a placeholder
+			log.Printf("Failed to create thumbnail placeholder: %v", err)
+		} else {
+			setPlaceholder(&result, placeholder)
+		}
+	case strings.HasPrefix(contentType, "image/"):
+		result.MediaType = "image"
+
+		// Compress and possibly convert the image, which also strips its metadata
+		compressed, err := compression.CompressImage(ctx, fileData)
+		if err != nil {
+			log.Printf("ProcessPost: %v", err)
+			return result, nil, imageError(err)
+		}
+		fileData, contentType = compressed.Data, compressed.ContentType
+
+		if hash, ok := compression.ImageHash(compressed.Image); ok {
+			result.Hashes = []uint64{hash}
+		}
+		if err := p.checkHashes(post.UserID, result.Hashes); err != nil {
+			return result, nil, err
+		}
+
+		metadata := compressed.Metadata
+		if len(metadata.Stripped) > 0 {
+			log.Printf("Stripped image metadata from %s: %s", item.UploadKey, strings.Join(metadata.Stripped, ", "))
+		}
+		if p.config.RetainMetadata {
+			result.CapturedAt = metadata.CapturedAt
+		}
+		setPlaceholder(&result, compression.ImagePlaceholder(compressed.Image))
+
+		renditions, err = compression.CreateImageRenditions(ctx, compressed.Image, contentType)
+		if err != nil {
+			// Log error but continue with only the full size image
+			log.Printf("Failed to create image renditions: %v", err)
+		}
+	default:
+		return result, nil, jobs.Permanent(errors.New("only image and video uploads are allowed"))
+	}
+
+	// Promote the processed files to their permanent keys
+	var uploaded []string
+	if thumbnailData != nil {
+		key := storage.NewObjectKey("thumbnail_"+item.FileName+".jpg", "image/jpeg")
+		if _, err := p.blob.Upload(ctx, key, thumbnailData, "image/jpeg"); err != nil {
+			// Log error but continue without a thumbnail
+			log.Printf("Failed to upload thumbnail: %v", err)
+		} else {
+			result.ThumbnailKey = &key
+			uploaded = append(uploaded, key)
+		}
+	}
+
+	result.MediaKey = storage.NewObjectKey(item.FileName, contentType)
+	if _, err := p.blob.Upload(ctx, result.MediaKey, fileData, contentType); err != nil {
+		return result, uploaded, err
+	}
+	uploaded = append(uploaded, result.MediaKey)
+
+	if hlsFiles != nil {
+		prefix := fmt.Sprintf("%s%d/", HLSPrefix(post.ID), position)
+		if err := p.uploadHLS(ctx, prefix, hlsFiles); err != nil {
+			// Log error but continue with only the MP4
+			log.Printf("Failed to upload HLS renditions: %v", err)
+			p.deletePrefix(prefix)
+		} else {
+			key := prefix + compression.HLSMasterPlaylist
+			result.PlaylistKey = &key
+		}
+	}
+
+	// Renditions are kept together under a per-item prefix, which is removed
+	// as a whole if the post fails
+	prefix := fmt.Sprintf("%s%d/", RenditionsPrefix(post.ID), position)
+	for _, rendition := range renditions {
+		key := prefix + strconv.Itoa(rendition.Width) + rendition.Extension()
+		if _, err := p.blob.Upload(ctx, key, rendition.Data, rendition.ContentType); err != nil {
+			return result, uploaded, err
+		}
+		result.Renditions = append(result.Renditions, models.Rendition{
+			Position:    position,
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+			ContentType: rendition.ContentType,
+			MediaKey:    key,
+		})
+	}
+
+	return result, uploaded, nil
+}
+
+// completePost stores a post's processed media and marks it ready, using the
+// first item as the cover shown in feeds. It returns sql.ErrNoRows if the post
+// was deleted or is no longer processing.
+func (p *Processor) completePost(post models.Post, media []models.PostMedia) error {
+	tx, err := p.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	cover := media[0]
+	result, err := tx.Exec(
+		`UPDATE posts SET media_key = $1, media_type = $2, thumbnail_key = $3, playlist_key = $4,
+			width = $5, height = $6, blurhash = $7, dominant_color = $8, status = $9, updated_at = $10
+		WHERE id = $11 AND status = $12`,
+		cover.MediaKey, cover.MediaType, cover.ThumbnailKey, cover.PlaylistKey,
+		cover.Width, cover.Height, cover.BlurHash, cover.DominantColor, models.PostStatusReady, now, post.ID, models.PostStatusProcessing,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, item := range media {
+		_, err = tx.Exec(
+			`INSERT INTO post_media (post_id, position, media_key, media_type, thumbnail_key, playlist_key, width, height, blurhash, dominant_color, captured_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			post.ID, item.Position, item.MediaKey, item.MediaType, item.ThumbnailKey, item.PlaylistKey,
+			item.Width, item.Height, item.BlurHash, item.DominantColor, item.CapturedAt, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store post media: %w", err)
+		}
+
+		for _, rendition := range item.Renditions {
+			_, err = tx.Exec(
+				`INSERT INTO media_renditions (post_id, position, width, height, content_type, media_key)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				post.ID, item.Position, rendition.Width, rendition.Height, rendition.ContentType, rendition.MediaKey,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to store image rendition: %w", err)
+			}
+		}
+
+		for frame, hash := range item.Hashes {
+			_, err = tx.Exec(
+				"INSERT INTO media_hashes (post_id, position, frame, hash) VALUES ($1, $2, $3, $4)",
+				post.ID, item.Position, frame, int64(hash),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to store media hash: %w", err)
+			}
+		}
+	}
+
+	// Users mentioned in the caption are told now that they can see the post
+	var mentioned []string
+	if err := tx.Select(&mentioned, "SELECT user_id FROM post_mentions WHERE post_id = $1", post.ID); err != nil {
+		return fmt.Errorf("failed to get mentions: %w", err)
+	}
+	for _, userID := range mentioned {
+		err = notifications.Notify(tx, notifications.Event{
+			Type:    models.NotificationMention,
+			UserID:  userID,
+			ActorID: post.UserID,
+			PostID:  post.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit post media: %w", err)
+	}
+	return nil
+}
+
+// PostFailed marks a post whose media could not be processed as failed
+func (p *Processor) PostFailed(ctx context.Context, job *jobs.Job, jobErr error) {
+	var payload ProcessPostPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		log.Printf("PostFailed: invalid payload for job %s: %v", job.ID, err)
+		return
+	}
+
+	// Permanent errors describe a problem with the upload itself and are shown
+	// to the owner; anything else is an internal failure
+	reason := "Processing failed, please try uploading again"
+	if jobs.IsPermanent(jobErr) {
+		reason = jobErr.Error()
+	}
+
+	_, err := p.db.Exec(
+		"UPDATE posts SET status = $1, status_reason = $2, updated_at = $3 WHERE id = $4 AND status = $5",
+		models.PostStatusFailed, reason, time.Now(), payload.PostID, models.PostStatusProcessing,
+	)
+	if err != nil {
+		log.Printf("PostFailed: failed to update post %s: %v", payload.PostID, err)
+	}
+
+	p.deleteStaged(payload.items())
+}
+
+// setPlaceholder stores an item's dimensions and placeholder
+func setPlaceholder(item *models.PostMedia, placeholder compression.Placeholder) {
+	item.Width = &placeholder.Width
+	item.Height = &placeholder.Height
+	item.BlurHash = &placeholder.BlurHash
+	item.DominantColor = &placeholder.DominantColor
+}
+
+// checkHashes rejects media matching blocked media or the owner's earlier
+// posts. Images sent with the post were already checked by CreatePost, but
+// videos, direct uploads and posts created meanwhile are only caught here.
+func (p *Processor) checkHashes(userID string, hashes []uint64) error {
+	err := p.validator.CheckHashes(p.db, userID, hashes)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// uploadHLS stores every file of an HLS stream under prefix
+func (p *Processor) uploadHLS(ctx context.Context, prefix string, files map[string][]byte) error {
+	for name, data := range files {
+		if _, err := p.blob.Upload(ctx, prefix+name, data, compression.HLSContentType(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePrefix removes every file under prefix, such as a partial HLS stream
+func (p *Processor) deletePrefix(prefix string) {
+	if err := p.blob.DeletePrefix(context.Background(), prefix); err != nil {
+		log.Printf("Warning: Failed to delete files from storage: %v, prefix: %s", err, prefix)
+	}
+}
+
+// deleteStaged removes uploads from the staging prefix once they are no longer needed
+func (p *Processor) deleteStaged(items []StagedItem) {
+	for _, item := range items {
+		if err := p.blob.Delete(context.Background(), item.UploadKey); err != nil {
+			log.Printf("Warning: Failed to delete staged upload: %v, key: %s", err, item.UploadKey)
+		}
+	}
+}
+
+// deleteObjects removes files uploaded by a job that did not complete
+func (p *Processor) deleteObjects(keys []string) {
+	for _, key := range keys {
+		if err := p.blob.Delete(context.Background(), key); err != nil {
+			log.Printf("Warning: Failed to delete file from storage: %v, key: %s", err, key)
+		}
+	}
+}
+
+// imageError explains why an image could not be compressed. Problems with the
+// image itself are permanent; anything else may succeed on a retry.
+func imageError(err error) error {
+	var unavailable *compression.DecoderUnavailableError
+	var decodeErr *compression.DecodeError
+	switch {
+	case errors.Is(err, compression.ErrTimeout):
+		return jobs.Permanent(errors.New("the image took too long to process"))
+	case errors.As(err, &unavailable):
+		return jobs.Permanent(fmt.Errorf("%s images can't be processed right now, please use JPEG, PNG or WebP", strings.ToUpper(unavailable.Format)))
+	case errors.As(err, &decodeErr):
+		return jobs.Permanent(errors.New("the image could not be read, it may be damaged"))
+	case errors.Is(err, compression.ErrUnsupportedFormat):
+		return jobs.Permanent(errors.New("the image could not be read, please use JPEG, PNG, WebP or HEIC"))
+	}
+	return err
+}
+
+// HLSPrefix is where the HLS streams of a post's videos are stored
+func HLSPrefix(postID string) string {
+	return "hls/" + postID + "/"
+}
+
+// RenditionsPrefix is where the resized copies of a post's images are stored
+func RenditionsPrefix(postID string) string {
+	return "renditions/" + postID + "/"
+}
+
+// ContentTypeFromExtension guesses a media file's content type from its name,
+// for clients (notably iOS) that send a missing or generic one
+func ContentTypeFromExtension(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".heic", ".heif":
+		return "image/heic"
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	case ".mov":
+		return "video/quicktime"
+	}
+	return ""
+}
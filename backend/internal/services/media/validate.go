@@ -0,0 +1,231 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"backend/configs"
+	"backend/internal/services/compression"
+)
+
+var (
+	// ErrUnsupportedMedia is returned for uploads that aren't an image or
+	// video format we can process
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+
+	// ErrMediaTooLarge is returned for uploads over the configured size,
+	// duration or resolution limits
+	ErrMediaTooLarge = errors.New("media exceeds limits")
+)
+
+// ValidationError explains why an upload was rejected. It wraps
+// ErrUnsupportedMedia or ErrMediaTooLarge.
+type ValidationError struct {
+	Err     error
+	Message string // Shown to the user
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Message for uploads whose content isn't a format we accept
+const unsupportedMessage = "Unsupported file type, please upload a JPEG, PNG, WebP or HEIC image or an MP4, WebM or MOV video"
+
+// Validator checks uploads against the configured media limits
+type Validator struct {
+	config configs.MediaConfig
+}
+
+// NewValidator creates a new upload validator
+func NewValidator(config configs.MediaConfig) *Validator {
+	return &Validator{config: config}
+}
+
+// MaxBytes returns the largest upload of any type that may be accepted
+func (v *Validator) MaxBytes() int64 {
+	if v.config.MaxImageBytes > v.config.MaxVideoBytes {
+		return v.config.MaxImageBytes
+	}
+	return v.config.MaxVideoBytes
+}
+
+// CheckDeclared checks the type and size a client says it is about to upload,
+// before any data has been received. The data itself is checked again by
+// Validate once it arrives.
+func (v *Validator) CheckDeclared(contentType string, size int64) error {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return v.checkSize("Image", size, v.config.MaxImageBytes)
+	case strings.HasPrefix(contentType, "video/"):
+		return v.checkSize("Video", size, v.config.MaxVideoBytes)
+	}
+	return &ValidationError{Err: ErrUnsupportedMedia, Message: unsupportedMessage}
+}
+
+// MaxImageBytes returns the largest image upload that may be accepted
+func (v *Validator) MaxImageBytes() int64 {
+	return v.config.MaxImageBytes
+}
+
+// Validate identifies an upload from its content rather than its name or
+// declared type, and checks it against the size limit for that type. Images
+// are also checked for their pixel count and videos probed for their duration
+// and resolution. It returns the detected content type.
+func (v *Validator) Validate(ctx context.Context, data []byte, fileName string) (string, error) {
+	contentType := SniffContentType(data)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return contentType, v.checkImage(data, contentType)
+	case strings.HasPrefix(contentType, "video/"):
+		if err := v.checkSize("Video", int64(len(data)), v.config.MaxVideoBytes); err != nil {
+			return contentType, err
+		}
+		return contentType, v.checkVideo(ctx, data, fileName)
+	}
+	return "", &ValidationError{Err: ErrUnsupportedMedia, Message: unsupportedMessage}
+}
+
+// ValidateImage is Validate for uploads that must be images, such as profile
+// pictures
+func (v *Validator) ValidateImage(data []byte) (string, error) {
+	contentType := SniffContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", &ValidationError{
+			Err:     ErrUnsupportedMedia,
+			Message: "Unsupported image type, please upload a JPEG, PNG, WebP or HEIC image",
+		}
+	}
+	return contentType, v.checkImage(data, contentType)
+}
+
+// checkImage checks an image against the size and pixel limits. The pixel
+// count is read from the header before anything decodes the image, since a
+// small file can declare enough pixels to exhaust memory.
+func (v *Validator) checkImage(data []byte, contentType string) error {
+	// Formats decoded by external tools are only accepted while one of
+	// them is installed
+	if format := strings.TrimPrefix(contentType, "image/"); !compression.CanDecode(format) {
+		return &ValidationError{
+			Err:     ErrUnsupportedMedia,
+			Message: strings.ToUpper(format) + " images are not supported on this server, please upload a JPEG, PNG or WebP",
+		}
+	}
+	if err := v.checkSize("Image", int64(len(data)), v.config.MaxImageBytes); err != nil {
+		return err
+	}
+
+	config, err := compression.DecodeImageConfig(data)
+	if err != nil {
+		log.Printf("Validate: %v", err)
+		return &ValidationError{Err: ErrUnsupportedMedia, Message: "The image could not be read, it may be damaged"}
+	}
+	if int64(config.Width)*int64(config.Height) > v.config.MaxImagePixels {
+		return &ValidationError{
+			Err:     ErrMediaTooLarge,
+			Message: fmt.Sprintf("Image resolution is too high, the limit is %d megapixels", v.config.MaxImagePixels/1000000),
+		}
+	}
+	return nil
+}
+
+// checkSize rejects uploads over limit
+func (v *Validator) checkSize(kind string, size, limit int64) error {
+	if size > limit {
+		return &ValidationError{
+			Err:     ErrMediaTooLarge,
+			Message: fmt.Sprintf("%s is too large, the limit is %d MB", kind, limit>>20),
+		}
+	}
+	return nil
+}
+
+// checkVideo rejects videos that are too long or too high resolution
+func (v *Validator) checkVideo(ctx context.Context, data []byte, fileName string) error {
+	info, err := compression.ProbeVideoData(ctx, data, fileName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Without ffprobe the limits can't be checked, so no video is accepted
+		if errors.Is(err, exec.ErrNotFound) {
+			log.Printf("Validate: ffprobe not found, rejecting video: %v", err)
+			return &ValidationError{Err: ErrUnsupportedMedia, Message: "Videos can't be uploaded right now, please try again later"}
+		}
+		log.Printf("Validate: %v", err)
+		return &ValidationError{Err: ErrUnsupportedMedia, Message: "The video could not be read"}
+	}
+
+	if duration := time.Duration(info.Duration * float64(time.Second)); duration > v.config.MaxVideoDuration {
+		return &ValidationError{
+			Err:     ErrMediaTooLarge,
+			Message: "Video is too long, the limit is " + formatDuration(v.config.MaxVideoDuration),
+		}
+	}
+	if info.Width > v.config.MaxVideoDimension || info.Height > v.config.MaxVideoDimension {
+		return &ValidationError{
+			Err:     ErrMediaTooLarge,
+			Message: fmt.Sprintf("Video resolution is too high, the limit is %d pixels on either side", v.config.MaxVideoDimension),
+		}
+	}
+	return nil
+}
+
+// formatDuration formats a limit in whole minutes where possible
+func formatDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		if d == time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+	return fmt.Sprintf("%d seconds", d/time.Second)
+}
+
+// SniffContentType identifies an image or video format from its leading
+// bytes. It returns "" for anything that isn't a format we can process.
+func SniffContentType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	case bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		// Matroska; WebM declares its own document type in the header
+		header := data
+		if len(header) > 64 {
+			header = header[:64]
+		}
+		if bytes.Contains(header, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return sniffISOBrand(string(data[8:12]))
+	}
+	return ""
+}
+
+// sniffISOBrand maps the major brand of an ISO base media file (MP4, MOV,
+// HEIC, ...) to its content type. Other brands share the container, such as
+// M4A audio and JPEG 2000, so only known video and HEIC brands are accepted.
+func sniffISOBrand(brand string) string {
+	switch brand {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+		return "image/heic"
+	case "qt  ":
+		return "video/quicktime"
+	case "3gp4", "3gp5", "3gp6", "3g2a":
+		return "video/3gpp"
+	case "isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "dash", "mmp4", "M4V ", "M4VP", "MSNV", "XAVC":
+		return "video/mp4"
+	}
+	return ""
+}
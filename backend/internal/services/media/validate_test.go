@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"backend/configs"
+)
+
+// isoHeader returns the start of an ISO base media file with the given major brand
+func isoHeader(brand string) []byte {
+	return append([]byte{0, 0, 0, 0x18}, []byte("ftyp"+brand+"\x00\x00\x00\x00")...)
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"text", []byte("hello, world"), ""},
+		{"jpeg", []byte{0xff, 0xd8, 0xff, 0xe0, 0, 0x10, 'J', 'F', 'I', 'F'}, "image/jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+		{"gif", []byte("GIF89a"), ""},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), "video/webm"},
+		{"matroska", []byte("\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska"), "video/x-matroska"},
+		{"mp4", isoHeader("isom"), "video/mp4"},
+		{"mp4 v2", isoHeader("mp42"), "video/mp4"},
+		{"m4v", isoHeader("M4V "), "video/mp4"},
+		{"quicktime", isoHeader("qt  "), "video/quicktime"},
+		{"3gpp", isoHeader("3gp5"), "video/3gpp"},
+		{"heic", isoHeader("heic"), "image/heic"},
+		{"heif", isoHeader("mif1"), "image/heic"},
+		{"m4a audio", isoHeader("M4A "), ""},
+		{"jpeg 2000", isoHeader("jp2 "), ""},
+		{"avif", isoHeader("avif"), ""},
+		{"truncated ftyp", []byte("\x00\x00\x00\x18ftypis"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffContentType(tt.data); got != tt.want {
+				t.Errorf("SniffContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateImage(t *testing.T) {
+	v := NewValidator(configs.MediaConfig{MaxImageBytes: 64 << 10, MaxImagePixels: 1000000})
+
+	small := encodePNG(t, 100, 100)
+	truncated := small[:16] // Cut off inside the header
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		err         error // nil if the image is accepted
+	}{
+		{"small png", small, "image/png", nil},
+		{"at the pixel limit", encodePNG(t, 1000, 1000), "image/png", nil},
+		{"over the pixel limit", encodePNG(t, 1001, 1000), "image/png", ErrMediaTooLarge},
+		{"over the size limit", append(small, make([]byte, 64<<10)...), "image/png", ErrMediaTooLarge},
+		{"damaged", truncated, "image/png", ErrUnsupportedMedia},
+		{"video", isoHeader("isom"), "", ErrUnsupportedMedia},
+		{"not an image", []byte("hello, world"), "", ErrUnsupportedMedia},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, err := v.ValidateImage(tt.data)
+			if contentType != tt.contentType {
+				t.Errorf("ValidateImage() content type = %q, want %q", contentType, tt.contentType)
+			}
+			if tt.err == nil {
+				if err != nil {
+					t.Errorf("ValidateImage() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, tt.err) {
+				t.Errorf("ValidateImage() error = %v, want a ValidationError for %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package notifications records what users should be told about and
+// describes it for display
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Event is something done by one user that another should be told about
+type Event struct {
+	Type      string // One of the models.Notification* types
+	UserID    string // Who is told
+	ActorID   string // Who did it
+	PostID    string
+	CommentID string // The new comment, or for replies the comment replied to
+}
+
+// Notify records an event, normally in the same transaction as the action
+// itself. Follows, likes, comments and replies join the recipient's unread
+// notification of the same kind for the same post or comment, if there is
+// one, so they read as "alice and 4 others liked your post"; repeats by the
+// same actor are ignored. Users aren't told about their own actions.
+func Notify(tx sqlx.Ext, event Event) error {
+	if event.ActorID == event.UserID {
+		return nil
+	}
+
+	now := time.Now()
+	var id string
+	err := sqlx.Get(tx, &id,
+		`INSERT INTO notifications (id, user_id, type, group_key, post_id, comment_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (user_id, group_key) WHERE read_at IS NULL DO UPDATE SET group_key = EXCLUDED.group_key
+		RETURNING id`,
+		uuid.New().String(), event.UserID, event.Type, groupKey(event),
+		nullable(event.PostID), nullable(event.CommentID), now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO notification_actors (notification_id, user_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		id, event.ActorID, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification actor: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// Already counted, e.g. a post liked again after an unlike
+		return nil
+	}
+
+	// Move the notification up to the newest actor
+	_, err = tx.Exec(
+		"UPDATE notifications SET comment_id = COALESCE($1, comment_id), updated_at = $2 WHERE id = $3",
+		nullable(event.CommentID), now, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	return nil
+}
+
+// groupKey returns the key of the notifications an event joins, or nil if it
+// always gets its own
+func groupKey(event Event) *string {
+	var key string
+	switch event.Type {
+	case models.NotificationFollow:
+		key = event.Type
+	case models.NotificationLike, models.NotificationComment:
+		key = event.Type + ":" + event.PostID
+	case models.NotificationReply:
+		key = event.Type + ":" + event.CommentID
+	default:
+		return nil
+	}
+	return &key
+}
+
+// Message describes a notification in a sentence, naming its most recent
+// actors, e.g. "alice and bob liked your post" or "alice and 4 others liked
+// your post"
+func Message(n models.Notification) string {
+	who := "Someone"
+	switch {
+	case len(n.Actors) == 0:
+	case n.ActorCount == 2 && len(n.Actors) >= 2:
+		who = n.Actors[0].Username + " and " + n.Actors[1].Username
+	case n.ActorCount > 2:
+		who = fmt.Sprintf("%s and %d others", n.Actors[0].Username, n.ActorCount-1)
+	default:
+		who = n.Actors[0].Username
+	}
+
+	switch n.Type {
+	case models.NotificationFollow:
+		return who + " started following you"
+	case models.NotificationLike:
+		return who + " liked your post"
+	case models.NotificationComment:
+		return who + " commented on your post"
+	case models.NotificationReply:
+		return who + " replied to your comment"
+	case models.NotificationMention:
+		if n.CommentID != nil {
+			return who + " mentioned you in a comment"
+		}
+		return who + " mentioned you in a post"
+	}
+	return who
+}
+
+func nullable(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
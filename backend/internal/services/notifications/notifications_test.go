@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"testing"
+
+	"backend/internal/models"
+)
+
+func actors(usernames ...string) []models.NotificationActor {
+	list := make([]models.NotificationActor, len(usernames))
+	for i, username := range usernames {
+		list[i] = models.NotificationActor{ID: username, Username: username}
+	}
+	return list
+}
+
+func TestMessage(t *testing.T) {
+	commentID := "c1"
+	tests := []struct {
+		name         string
+		notification models.Notification
+		want         string
+	}{
+		{
+			"single follower",
+			models.Notification{Type: models.NotificationFollow, Actors: actors("alice"), ActorCount: 1},
+			"alice started following you",
+		},
+		{
+			"two likers",
+			models.Notification{Type: models.NotificationLike, Actors: actors("alice", "bob"), ActorCount: 2},
+			"alice and bob liked your post",
+		},
+		{
+			"many commenters",
+			models.Notification{Type: models.NotificationComment, Actors: actors("alice", "bob", "carol"), ActorCount: 5},
+			"alice and 4 others commented on your post",
+		},
+		{
+			"three repliers",
+			models.Notification{Type: models.NotificationReply, Actors: actors("alice", "bob", "carol"), ActorCount: 3},
+			"alice and 2 others replied to your comment",
+		},
+		{
+			"two actors but only one loaded",
+			models.Notification{Type: models.NotificationLike, Actors: actors("alice"), ActorCount: 2},
+			"alice liked your post",
+		},
+		{
+			"no actors left",
+			models.Notification{Type: models.NotificationLike, ActorCount: 0},
+			"Someone liked your post",
+		},
+		{
+			"mention in a post",
+			models.Notification{Type: models.NotificationMention, Actors: actors("alice"), ActorCount: 1},
+			"alice mentioned you in a post",
+		},
+		{
+			"mention in a comment",
+			models.Notification{Type: models.NotificationMention, CommentID: &commentID, Actors: actors("alice"), ActorCount: 1},
+			"alice mentioned you in a comment",
+		},
+		{
+			"unknown type",
+			models.Notification{Type: "unknown", Actors: actors("alice"), ActorCount: 1},
+			"alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.notification); got != tt.want {
+				t.Errorf("Message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupKey(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string // "" for no group
+	}{
+		{Event{Type: models.NotificationFollow, PostID: "p1"}, "follow"},
+		{Event{Type: models.NotificationLike, PostID: "p1"}, "like:p1"},
+		{Event{Type: models.NotificationComment, PostID: "p1", CommentID: "c1"}, "comment:p1"},
+		{Event{Type: models.NotificationReply, PostID: "p1", CommentID: "c1"}, "reply:c1"},
+		{Event{Type: models.NotificationMention, PostID: "p1"}, ""},
+	}
+
+	for _, tt := range tests {
+		key := groupKey(tt.event)
+		got := ""
+		if key != nil {
+			got = *key
+		}
+		if got != tt.want {
+			t.Errorf("groupKey(%+v) = %q, want %q", tt.event, got, tt.want)
+		}
+	}
+}
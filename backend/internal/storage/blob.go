@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"backend/configs"
+
+	"github.com/google/uuid"
+)
+
+// Blob is a store for uploaded media files
+type Blob interface {
+	// Upload stores data at key and returns its public URL
+	Upload(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Delete removes the file referenced by a key or public URL
+	Delete(ctx context.Context, ref string) error
+	// DeletePrefix removes every file whose key starts with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+	// PublicURL returns the URL at which key is served
+	PublicURL(key string) string
+	// PresignedURL returns a URL for key that stops working after duration
+	PresignedURL(ctx context.Context, key string, duration time.Duration) (string, error)
+	// ObjectKey resolves a key or public URL to the key it refers to
+	ObjectKey(ref string) (string, error)
+	// PresignedUploadURL returns a URL a client can PUT exactly size bytes of
+	// contentType to at key, until duration has passed
+	PresignedUploadURL(ctx context.Context, key string, contentType string, size int64, duration time.Duration) (string, error)
+	// Download reads at most maxBytes of the file at key, returning its data
+	// and content type
+	Download(ctx context.Context, key string, maxBytes int64) ([]byte, string, error)
+}
+
+// Errors returned by Blob implementations
+var (
+	ErrNotFound         = errors.New("object not found")
+	ErrTooLarge         = errors.New("object exceeds the size limit")
+	ErrPresignedUploads = errors.New("storage driver does not support presigned uploads")
+)
+
+// StagingPrefix is where clients upload files directly before a post is
+// created from them. Objects left here are never promoted, so the bucket
+// should expire the prefix with a lifecycle rule.
+const StagingPrefix = "uploads/"
+
+// NewBlob creates the storage backend selected in the configuration
+func NewBlob(config *configs.Config) (Blob, error) {
+	switch config.Storage.Driver {
+	case configs.StorageDriverLocal:
+		return NewLocalStore(config.Storage)
+	case configs.StorageDriverS3:
+		return NewS3Client(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", config.Storage.Driver)
+	}
+}
+
+// NewObjectKey generates a unique key for an uploaded file, grouped into a
+// folder by content type
+func NewObjectKey(fileName string, contentType string) string {
+	// Generate unique file name
+	ext := filepath.Ext(fileName)
+	uniqueFileName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+
+	// Set folder based on content type
+	var folder string
+	if contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif" {
+		folder = "images/"
+	} else if contentType == "video/mp4" || contentType == "video/webm" {
+		folder = "videos/"
+	} else {
+		folder = "files/"
+	}
+
+	return folder + uniqueFileName
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backend/configs"
+)
+
+// LocalMediaRoute is the URL path the local store's files are served under
+const LocalMediaRoute = "/media"
+
+// LocalStore keeps files in a directory on disk, for local development and
+// testing without an S3 endpoint. The API serves the directory itself.
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore creates a filesystem store, creating its directory if needed
+func NewLocalStore(config configs.StorageConfig) (*LocalStore, error) {
+	if err := os.MkdirAll(config.LocalDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStore{
+		dir:     config.LocalDir,
+		baseURL: strings.TrimSuffix(config.PublicURL, "/") + LocalMediaRoute,
+	}, nil
+}
+
+// Upload writes a file to disk and returns its public URL
+func (s *LocalStore) Upload(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return s.PublicURL(key), nil
+}
+
+// Delete removes a file from disk
+func (s *LocalStore) Delete(ctx context.Context, ref string) error {
+	key, err := s.ObjectKey(ref)
+	if err != nil {
+		return err
+	}
+
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	log.Printf("Successfully deleted local file: key=%s", key)
+	return nil
+}
+
+// DeletePrefix removes the directory holding every file under a key prefix.
+// Prefixes are expected to end at a directory boundary, such as "hls/<id>/".
+func (s *LocalStore) DeletePrefix(ctx context.Context, prefix string) error {
+	dirPath, err := s.filePath(prefix)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dirPath); err != nil {
+		return fmt.Errorf("failed to delete directory: %w", err)
+	}
+
+	log.Printf("Successfully deleted local files: prefix=%s", prefix)
+	return nil
+}
+
+// PublicURL returns the URL the file is served at
+func (s *LocalStore) PublicURL(key string) string {
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// PresignedURL returns the public URL, since local files are never private.
+// The configuration rejects PRIVATE_MEDIA with the local driver.
+func (s *LocalStore) PresignedURL(ctx context.Context, key string, duration time.Duration) (string, error) {
+	return s.PublicURL(key), nil
+}
+
+// ObjectKey resolves a public URL back to the key it was stored under
+func (s *LocalStore) ObjectKey(ref string) (string, error) {
+	if !strings.HasPrefix(ref, s.baseURL+"/") {
+		return ref, nil
+	}
+
+	key, err := url.PathUnescape(strings.TrimPrefix(ref, s.baseURL+"/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid local media URL: %w", err)
+	}
+	return key, nil
+}
+
+// PresignedUploadURL is not supported, since files on disk can only be
+// written through the API
+func (s *LocalStore) PresignedUploadURL(ctx context.Context, key string, contentType string, size int64, duration time.Duration) (string, error) {
+	return "", ErrPresignedUploads
+}
+
+// Download reads a file from disk, taking its content type from the extension
+func (s *LocalStore) Download(ctx context.Context, key string, maxBytes int64) ([]byte, string, error) {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	return data, mime.TypeByExtension(path.Ext(key)), nil
+}
+
+// filePath maps a key to a path inside the storage directory. Keys must
+// already be clean and relative; any that would be rewritten by cleaning, such
+// as ones climbing out through "..", are rejected rather than resolved to some
+// other object.
+func (s *LocalStore) filePath(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		path.IsAbs(key) || cleaned != strings.TrimSuffix(key, "/") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"backend/configs"
+)
+
+func newTestStore(t *testing.T) *LocalStore {
+	t.Helper()
+	store, err := NewLocalStore(configs.StorageConfig{LocalDir: t.TempDir(), PublicURL: "http://localhost:8080/"})
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+	return store
+}
+
+func TestLocalStoreFilePath(t *testing.T) {
+	store := newTestStore(t)
+
+	tests := []struct {
+		key  string
+		want string // Relative to the storage directory, "" if rejected
+	}{
+		{"posts/photo.jpg", "posts/photo.jpg"},
+		{"hls/abc/", "hls/abc"},
+		{"avatars/a/b/c.webp", "avatars/a/b/c.webp"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"/", ""},
+		{"../secret", ""},
+		{"/etc/passwd", ""},
+		{"uploads/../posts/photo.jpg", ""},
+		{"uploads/user/../../../etc", ""},
+		{"uploads//photo.jpg", ""},
+		{"uploads/./photo.jpg", ""},
+		{"posts/photo.jpg//", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := store.filePath(tt.key)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("filePath(%q) = %q, want an error", tt.key, got)
+			}
+			continue
+		}
+		if want := filepath.Join(store.dir, filepath.FromSlash(tt.want)); err != nil || got != want {
+			t.Errorf("filePath(%q) = %q, %v; want %q", tt.key, got, err, want)
+		}
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	url, err := store.Upload(ctx, "hls/post 1/index.m3u8", []byte("#EXTM3U"), "application/vnd.apple.mpegurl")
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if want := "http://localhost:8080/media/hls/post%201/index.m3u8"; url != want {
+		t.Errorf("Upload() URL = %q, want %q", url, want)
+	}
+	if key, err := store.ObjectKey(url); err != nil || key != "hls/post 1/index.m3u8" {
+		t.Errorf("ObjectKey(%q) = %q, %v", url, key, err)
+	}
+
+	data, _, err := store.Download(ctx, "hls/post 1/index.m3u8", 7)
+	if err != nil || string(data) != "#EXTM3U" {
+		t.Errorf("Download() = %q, %v", data, err)
+	}
+	if _, _, err := store.Download(ctx, "hls/post 1/index.m3u8", 6); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Download() over the limit error = %v, want ErrTooLarge", err)
+	}
+
+	if err := store.DeletePrefix(ctx, "hls/post 1/"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if _, _, err := store.Download(ctx, "hls/post 1/index.m3u8", 7); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Download() after DeletePrefix error = %v, want ErrNotFound", err)
+	}
+
+	// Deleting by URL or key of a missing file isn't an error
+	if err := store.Delete(ctx, url); err != nil {
+		t.Errorf("Delete() of a missing file error = %v", err)
+	}
+	if _, err := store.Upload(ctx, "../outside.txt", []byte("x"), "text/plain"); err == nil {
+		t.Error("Upload() outside the storage directory succeeded")
+	}
+}
@@ -3,7 +3,9 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"path/filepath"
@@ -16,7 +18,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Client handles file operations with AWS S3
@@ -75,25 +77,8 @@ func NewS3Client(config configs.S3Config) (*S3Client, error) {
 	}, nil
 }
 
-// UploadFile uploads a file to S3
-func (s *S3Client) UploadFile(ctx context.Context, fileData []byte, fileName string, contentType string) (string, error) {
-	// Generate unique file name
-	ext := filepath.Ext(fileName)
-	uniqueFileName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-
-	// Set folder based on content type
-	var folder string
-	if contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif" {
-		folder = "images/"
-	} else if contentType == "video/mp4" || contentType == "video/webm" {
-		folder = "videos/"
-	} else {
-		folder = "files/"
-	}
-
-	// Full path in S3
-	s3Path := folder + uniqueFileName
-
+// Upload uploads a file to S3 at the given key and returns its public URL
+func (s *S3Client) Upload(ctx context.Context, s3Path string, fileData []byte, contentType string) (string, error) {
 	// Upload to S3
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
@@ -106,22 +91,25 @@ func (s *S3Client) UploadFile(ctx context.Context, fileData []byte, fileName str
 	}
 
 	// Return public URL
-	return s.GetPublicURL(s3Path), nil
+	return s.PublicURL(s3Path), nil
 }
 
-// GetPublicURL returns a public URL for a file
-func (s *S3Client) GetPublicURL(s3Path string) string {
+// PublicURL returns a public URL for a file. Slashes in the key are kept so
+// that relative references between files, as in HLS playlists, resolve.
+func (s *S3Client) PublicURL(s3Path string) string {
+	escapedPath := (&url.URL{Path: s3Path}).EscapedPath()
+
 	// For custom endpoints
 	if s.client.Options().BaseEndpoint != nil {
-		return fmt.Sprintf("%s/%s/%s", *s.client.Options().BaseEndpoint, s.bucket, url.PathEscape(s3Path))
+		return fmt.Sprintf("%s/%s/%s", *s.client.Options().BaseEndpoint, s.bucket, escapedPath)
 	}
 
 	// Standard S3 URL format
-	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, url.PathEscape(s3Path))
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, escapedPath)
 }
 
-// GetPresignedURL gets a presigned URL for a file
-func (s *S3Client) GetPresignedURL(ctx context.Context, s3Path string, duration time.Duration) (string, error) {
+// PresignedURL gets a presigned URL for a file
+func (s *S3Client) PresignedURL(ctx context.Context, s3Path string, duration time.Duration) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
 	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
@@ -137,16 +125,125 @@ func (s *S3Client) GetPresignedURL(ctx context.Context, s3Path string, duration
 	return request.URL, nil
 }
 
-// DeleteFile deletes a file from S3
-func (s *S3Client) DeleteFile(ctx context.Context, s3Path string) error {
+// PresignedUploadURL gets a presigned URL for uploading a file directly to S3.
+// The content type and length are signed, so the client must send both as given.
+func (s *S3Client) PresignedUploadURL(ctx context.Context, s3Path string, contentType string, size int64, duration time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(s3Path),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = duration
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned upload URL: %w", err)
+	}
+
+	return request.URL, nil
+}
+
+// Download reads a file from S3
+func (s *S3Client) Download(ctx context.Context, s3Path string, maxBytes int64) ([]byte, string, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Path),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", fmt.Errorf("failed to download file from S3: %w", err)
+	}
+	defer output.Body.Close()
+
+	if output.ContentLength != nil && *output.ContentLength > maxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(output.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file from S3: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	return data, aws.ToString(output.ContentType), nil
+}
+
+// Delete deletes a file from S3
+func (s *S3Client) Delete(ctx context.Context, s3Path string) error {
 	// Log the deletion attempt for debugging
 	log.Printf("Attempting to delete file from S3: bucket=%s, key=%s", s.bucket, s3Path)
 
+	s3Path, err := s.ObjectKey(s3Path)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Final S3 path for deletion: bucket=%s, key=%s", s.bucket, s3Path)
+
+	// Execute the delete operation
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Path),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete file from S3: %w", err)
+	}
+
+	// Log success
+	log.Printf("Successfully deleted file from S3: bucket=%s, key=%s", s.bucket, s3Path)
+	return nil
+}
+
+// DeletePrefix deletes every file under a key prefix from S3
+func (s *S3Client) DeletePrefix(ctx context.Context, prefix string) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list files in S3: %w", err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		// A page holds at most 1000 keys, the DeleteObjects limit
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: object.Key}
+		}
+		_, err = s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete files from S3: %w", err)
+		}
+	}
+
+	log.Printf("Successfully deleted files from S3: bucket=%s, prefix=%s", s.bucket, prefix)
+	return nil
+}
+
+// ObjectKey resolves a stored media reference (either a public URL or a bare
+// key) to the object key it refers to in the bucket
+func (s *S3Client) ObjectKey(s3Path string) (string, error) {
 	// If s3Path is a full URL, extract just the path component
 	if strings.HasPrefix(s3Path, "http://") || strings.HasPrefix(s3Path, "https://") {
 		parsedURL, err := url.Parse(s3Path)
 		if err != nil {
-			return fmt.Errorf("invalid URL format for S3 path: %w", err)
+			return "", fmt.Errorf("invalid URL format for S3 path: %w", err)
 		}
 
 		// Extract path from URL
@@ -167,7 +264,11 @@ func (s *S3Client) DeleteFile(ctx context.Context, s3Path string) error {
 	// Check if we're missing the folder prefix for media files
 	if !strings.HasPrefix(s3Path, "images/") &&
 		!strings.HasPrefix(s3Path, "videos/") &&
-		!strings.HasPrefix(s3Path, "files/") {
+		!strings.HasPrefix(s3Path, "files/") &&
+		!strings.HasPrefix(s3Path, "avatars/") &&
+		!strings.HasPrefix(s3Path, "hls/") &&
+		!strings.HasPrefix(s3Path, "renditions/") &&
+		!strings.HasPrefix(s3Path, StagingPrefix) {
 
 		// Check file extension to determine folder
 		ext := strings.ToLower(filepath.Ext(s3Path))
@@ -180,19 +281,5 @@ func (s *S3Client) DeleteFile(ctx context.Context, s3Path string) error {
 		}
 	}
 
-	log.Printf("Final S3 path for deletion: bucket=%s, key=%s", s.bucket, s3Path)
-
-	// Execute the delete operation
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Path),
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to delete file from S3: %w", err)
-	}
-
-	// Log success
-	log.Printf("Successfully deleted file from S3: bucket=%s, key=%s", s.bucket, s3Path)
-	return nil
+	return s3Path, nil
 }
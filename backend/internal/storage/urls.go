@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/configs"
+)
+
+// URLSigner turns object keys into URLs clients can load. With private media
+// enabled every URL is presigned and expires; otherwise keys map to public URLs.
+type URLSigner struct {
+	blob    Blob
+	private bool
+	expiry  time.Duration
+}
+
+// NewURLSigner creates a signer for the configured media visibility
+func NewURLSigner(blob Blob, config configs.StorageConfig) *URLSigner {
+	return &URLSigner{
+		blob:    blob,
+		private: config.PrivateMedia,
+		expiry:  config.URLExpiry,
+	}
+}
+
+// Batch starts a set of URLs rendered for one response. Each distinct key is
+// signed once per batch, so a feed repeating an avatar signs it only once.
+func (s *URLSigner) Batch(ctx context.Context) *URLBatch {
+	return &URLBatch{
+		ctx:    ctx,
+		signer: s,
+		urls:   make(map[string]string),
+	}
+}
+
+// URLBatch caches the URLs rendered for a single response
+type URLBatch struct {
+	ctx    context.Context
+	signer *URLSigner
+	urls   map[string]string
+}
+
+// URL returns the URL for key, or "" for an empty key. A key that cannot be
+// signed is logged and rendered as "" rather than failing the response.
+func (b *URLBatch) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	if url, ok := b.urls[key]; ok {
+		return url
+	}
+
+	url := b.signer.blob.PublicURL(key)
+	if b.signer.private {
+		signed, err := b.signer.blob.PresignedURL(b.ctx, key, b.signer.expiry)
+		if err != nil {
+			log.Printf("Warning: Failed to presign media URL: %v, key: %s", err, key)
+			signed = ""
+		}
+		url = signed
+	}
+
+	b.urls[key] = url
+	return url
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS followers;
+DROP TABLE IF EXISTS post_likes;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS invite_codes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
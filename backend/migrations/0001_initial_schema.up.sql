@@ -0,0 +1,102 @@
+-- Baseline schema. Written to be idempotent so that databases created by the
+-- old InitSchema table checks are adopted without changes.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(36) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    name VARCHAR(255),
+    phone_number VARCHAR(20),
+    profile_picture VARCHAR(255),
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT,
+    device VARCHAR(255),
+    ip_address VARCHAR(45),
+    last_active TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Invite codes table
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id VARCHAR(36) PRIMARY KEY,
+    code VARCHAR(36) NOT NULL UNIQUE,
+    created_by VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_by VARCHAR(36) REFERENCES users(id) ON DELETE SET NULL,
+    used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Posts table
+CREATE TABLE IF NOT EXISTS posts (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    caption TEXT,
+    media_url TEXT NOT NULL,
+    media_type VARCHAR(10) NOT NULL,
+    thumbnail_url TEXT,
+    likes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS thumbnail_url TEXT;
+
+-- Comments table
+CREATE TABLE IF NOT EXISTS comments (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Post likes table
+CREATE TABLE IF NOT EXISTS post_likes (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE(post_id, user_id)
+);
+
+-- Followers table
+CREATE TABLE IF NOT EXISTS followers (
+    id VARCHAR(36) PRIMARY KEY,
+    follower_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followed_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE(follower_id, followed_id)
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created_by ON invite_codes(created_by);
+CREATE INDEX IF NOT EXISTS idx_invite_codes_used_by ON invite_codes(used_by);
+CREATE INDEX IF NOT EXISTS idx_invite_codes_code ON invite_codes(code);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_post_likes_post_id ON post_likes(post_id);
+CREATE INDEX IF NOT EXISTS idx_post_likes_user_id ON post_likes(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers(follower_id);
+CREATE INDEX IF NOT EXISTS idx_followers_followed_id ON followers(followed_id);
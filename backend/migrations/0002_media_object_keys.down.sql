@@ -0,0 +1,4 @@
+-- Column names only; keys are not converted back into URLs
+ALTER TABLE users RENAME COLUMN profile_picture_key TO profile_picture;
+ALTER TABLE posts RENAME COLUMN thumbnail_key TO thumbnail_url;
+ALTER TABLE posts RENAME COLUMN media_key TO media_url;
@@ -0,0 +1,6 @@
+-- Media columns hold storage object keys (e.g. images/<uuid>.jpg) rather than
+-- public URLs. URLs are rendered at response time. Rows still holding URLs are
+-- converted by database.BackfillMediaKeys when the server starts.
+ALTER TABLE posts RENAME COLUMN media_url TO media_key;
+ALTER TABLE posts RENAME COLUMN thumbnail_url TO thumbnail_key;
+ALTER TABLE users RENAME COLUMN profile_picture TO profile_picture_key;
@@ -0,0 +1,22 @@
+-- Background job queue, polled by worker goroutines with FOR UPDATE SKIP LOCKED
+CREATE TABLE jobs (
+    id VARCHAR(36) PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, running, done, failed
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 3,
+    last_error TEXT,
+    run_at TIMESTAMP NOT NULL,
+    locked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_jobs_pending ON jobs(run_at) WHERE status = 'pending';
+CREATE INDEX idx_jobs_running ON jobs(locked_at) WHERE status = 'running';
+
+-- Posts are created as 'processing' and become 'ready' once their media has
+-- been processed. Existing posts are already complete.
+ALTER TABLE posts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'ready';
+CREATE INDEX idx_posts_status ON posts(status);
@@ -0,0 +1,2 @@
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_status_check;
+ALTER TABLE posts DROP COLUMN IF EXISTS status_reason;
@@ -0,0 +1,5 @@
+-- Why a post is failed or removed, shown to its owner
+ALTER TABLE posts ADD COLUMN status_reason TEXT;
+
+ALTER TABLE posts ADD CONSTRAINT posts_status_check
+    CHECK (status IN ('processing', 'ready', 'failed', 'removed'));
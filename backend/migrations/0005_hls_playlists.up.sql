@@ -0,0 +1,2 @@
+-- Master playlist of a video's HLS renditions, stored under hls/<post id>/
+ALTER TABLE posts ADD COLUMN playlist_key TEXT;
@@ -0,0 +1,18 @@
+-- Ordered media items of a post. The posts media columns keep describing the
+-- first item, which feeds use as the cover.
+CREATE TABLE post_media (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    media_key TEXT NOT NULL,
+    media_type VARCHAR(10) NOT NULL,
+    thumbnail_key TEXT,
+    playlist_key TEXT,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, position)
+);
+
+-- Every existing post becomes a single-item post
+INSERT INTO post_media (post_id, position, media_key, media_type, thumbnail_key, playlist_key, created_at)
+SELECT id, 0, media_key, media_type, thumbnail_key, playlist_key, created_at
+FROM posts
+WHERE status = 'ready';
@@ -0,0 +1,3 @@
+ALTER TABLE post_media DROP COLUMN IF EXISTS captured_at;
+ALTER TABLE post_media DROP COLUMN IF EXISTS height;
+ALTER TABLE post_media DROP COLUMN IF EXISTS width;
@@ -0,0 +1,5 @@
+-- Safe metadata kept from images when MEDIA_RETAIN_METADATA is set. Location,
+-- device and all other embedded metadata is always stripped.
+ALTER TABLE post_media ADD COLUMN width INT;
+ALTER TABLE post_media ADD COLUMN height INT;
+ALTER TABLE post_media ADD COLUMN captured_at TIMESTAMP;
@@ -0,0 +1,12 @@
+-- Resized and re-encoded copies of each image item, for responsive loading.
+-- Keys live under renditions/<post id>/<position>/.
+CREATE TABLE media_renditions (
+    post_id VARCHAR(36) NOT NULL,
+    position INT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    content_type VARCHAR(20) NOT NULL,
+    media_key TEXT NOT NULL,
+    PRIMARY KEY (post_id, position, content_type, width),
+    FOREIGN KEY (post_id, position) REFERENCES post_media(post_id, position) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blocked_hashes;
+DROP TABLE IF EXISTS media_hashes;
@@ -0,0 +1,21 @@
+-- Perceptual hashes of each media item: one for an image, one per sampled
+-- keyframe of a video. Posts processed before this have none.
+CREATE TABLE media_hashes (
+    post_id VARCHAR(36) NOT NULL,
+    position INT NOT NULL,
+    frame INT NOT NULL,
+    hash BIGINT NOT NULL,
+    PRIMARY KEY (post_id, position, frame),
+    FOREIGN KEY (post_id, position) REFERENCES post_media(post_id, position) ON DELETE CASCADE
+);
+
+-- Hashes of media taken down by moderators, which can't be posted again.
+-- The post is only recorded for reference and may since have been deleted.
+CREATE TABLE blocked_hashes (
+    id VARCHAR(36) PRIMARY KEY,
+    hash BIGINT NOT NULL UNIQUE,
+    reason TEXT NOT NULL,
+    post_id VARCHAR(36),
+    created_by VARCHAR(36) REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
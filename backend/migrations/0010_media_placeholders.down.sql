@@ -0,0 +1,6 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS dominant_color;
+ALTER TABLE posts DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE posts DROP COLUMN IF EXISTS height;
+ALTER TABLE posts DROP COLUMN IF EXISTS width;
+ALTER TABLE post_media DROP COLUMN IF EXISTS dominant_color;
+ALTER TABLE post_media DROP COLUMN IF EXISTS blurhash;
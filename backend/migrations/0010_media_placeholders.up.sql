@@ -0,0 +1,15 @@
+-- Placeholders painted while media loads. Width and height are now stored for
+-- every item, not only when image metadata is retained.
+ALTER TABLE post_media ADD COLUMN blurhash TEXT;
+ALTER TABLE post_media ADD COLUMN dominant_color VARCHAR(7);
+
+-- The cover's placeholder, so feeds can use it without the items
+ALTER TABLE posts ADD COLUMN width INT;
+ALTER TABLE posts ADD COLUMN height INT;
+ALTER TABLE posts ADD COLUMN blurhash TEXT;
+ALTER TABLE posts ADD COLUMN dominant_color VARCHAR(7);
+
+UPDATE posts p
+SET width = pm.width, height = pm.height
+FROM post_media pm
+WHERE pm.post_id = p.id AND pm.position = 0;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_comments_parent_comment_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_comment_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+
+-- Replies become top-level comments; the blanked tombstones go
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+ALTER TABLE comments DROP CONSTRAINT comments_user_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE comments ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,13 @@
+-- Replies to comments, nested at most two levels below a top-level comment.
+-- Deleting a comment that has replies blanks it and sets deleted_at instead,
+-- so the thread survives. Comments are never cascaded away with their parent.
+ALTER TABLE comments ADD COLUMN parent_comment_id VARCHAR(36) REFERENCES comments(id) ON DELETE SET NULL;
+ALTER TABLE comments ADD COLUMN depth INT NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMP;
+
+-- Tombstones outlive their author, losing only the user they belonged to
+ALTER TABLE comments ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE comments DROP CONSTRAINT comments_user_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_comments_parent_comment_id ON comments(parent_comment_id, created_at);
@@ -0,0 +1,12 @@
+-- Likes on comments, counted in comments.likes like posts.likes
+CREATE TABLE comment_likes (
+    id VARCHAR(36) PRIMARY KEY,
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE(comment_id, user_id)
+);
+
+CREATE INDEX idx_comment_likes_user_id ON comment_likes(user_id);
+
+ALTER TABLE comments ADD COLUMN likes INT NOT NULL DEFAULT 0;
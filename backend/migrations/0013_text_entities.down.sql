@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS comment_hashtags;
+DROP TABLE IF EXISTS comment_mentions;
+DROP TABLE IF EXISTS post_hashtags;
+DROP TABLE IF EXISTS post_mentions;
+ALTER TABLE comments DROP COLUMN IF EXISTS content_entities;
+ALTER TABLE posts DROP COLUMN IF EXISTS caption_entities;
@@ -0,0 +1,33 @@
+-- Mentions and hashtags found in captions and comments. The entities column
+-- keeps their positions for rendering; the join tables are for lookups.
+-- Text written before this has no entities until it is edited.
+ALTER TABLE posts ADD COLUMN caption_entities JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE comments ADD COLUMN content_entities JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE post_mentions (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, user_id)
+);
+CREATE INDEX idx_post_mentions_user_id ON post_mentions(user_id);
+
+CREATE TABLE post_hashtags (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag VARCHAR(100) NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+CREATE INDEX idx_post_hashtags_tag ON post_hashtags(tag);
+
+CREATE TABLE comment_mentions (
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
+CREATE INDEX idx_comment_mentions_user_id ON comment_mentions(user_id);
+
+CREATE TABLE comment_hashtags (
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    tag VARCHAR(100) NOT NULL,
+    PRIMARY KEY (comment_id, tag)
+);
+CREATE INDEX idx_comment_hashtags_tag ON comment_hashtags(tag);
@@ -0,0 +1,29 @@
+-- Notifications of follows, likes, comments, replies and mentions. Likes,
+-- follows, comments and replies join the recipient's unread notification with
+-- the same group key, so at most one of each group is unread at a time;
+-- mentions have no key and are never merged.
+CREATE TABLE notifications (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL,
+    group_key VARCHAR(100),
+    post_id VARCHAR(36) REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id VARCHAR(36) REFERENCES comments(id) ON DELETE SET NULL,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id, updated_at DESC, id DESC);
+CREATE UNIQUE INDEX idx_notifications_unread_group ON notifications(user_id, group_key) WHERE read_at IS NULL;
+
+-- Users who caused a notification; a notification whose actors have all
+-- deleted their accounts isn't shown
+CREATE TABLE notification_actors (
+    notification_id VARCHAR(36) NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (notification_id, user_id)
+);
+
+CREATE INDEX idx_notification_actors_user_id ON notification_actors(user_id);
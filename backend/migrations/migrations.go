@@ -0,0 +1,11 @@
+// Package migrations embeds the versioned SQL migrations applied by the
+// database package. Files are named <version>_<name>.up.sql with a matching
+// <version>_<name>.down.sql, and must never be edited once released.
+package migrations
+
+import "embed"
+
+// Files holds every migration in this directory
+//
+//go:embed *.sql
+var Files embed.FS
@@ -1,75 +0,0 @@
--- Users table
-CREATE TABLE users (
-    id VARCHAR(36) PRIMARY KEY,
-    username VARCHAR(255) NOT NULL UNIQUE,
-    email VARCHAR(255) NOT NULL UNIQUE,
-    password_hash VARCHAR(255) NOT NULL,
-    name VARCHAR(255),
-    phone_number VARCHAR(20),
-    profile_picture VARCHAR(255),
-    created_at TIMESTAMP NOT NULL,
-    updated_at TIMESTAMP NOT NULL
-);
-
--- Sessions table
-CREATE TABLE sessions (
-    id VARCHAR(36) PRIMARY KEY,
-    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    token TEXT,
-    device VARCHAR(255),
-    ip_address VARCHAR(45),
-    last_active TIMESTAMP NOT NULL,
-    expires_at TIMESTAMP NOT NULL,
-    created_at TIMESTAMP NOT NULL
-);
-
--- Posts table
-CREATE TABLE posts (
-    id VARCHAR(36) PRIMARY KEY,
-    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    caption TEXT,
-    media_url TEXT NOT NULL,
-    media_type VARCHAR(10) NOT NULL,
-    likes INT NOT NULL DEFAULT 0,
-    created_at TIMESTAMP NOT NULL,
-    updated_at TIMESTAMP NOT NULL
-);
-
--- Comments table
-CREATE TABLE comments (
-    id VARCHAR(36) PRIMARY KEY,
-    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
-    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    content TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL,
-    updated_at TIMESTAMP NOT NULL
-);
-
--- Post likes table
-CREATE TABLE post_likes (
-    id VARCHAR(36) PRIMARY KEY,
-    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
-    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    created_at TIMESTAMP NOT NULL,
-    UNIQUE(post_id, user_id)
-);
-
-CREATE TABLE followers (
-    id VARCHAR(36) PRIMARY KEY,
-    follower_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    followed_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    created_at TIMESTAMP NOT NULL,
-    UNIQUE(follower_id, followed_id)
-);
-
--- Indexes
-CREATE INDEX idx_sessions_user_id ON sessions(user_id);
-CREATE INDEX idx_posts_user_id ON posts(user_id);
-CREATE INDEX idx_comments_post_id ON comments(post_id);
-CREATE INDEX idx_comments_user_id ON comments(user_id);
-
-CREATE INDEX idx_post_likes_post_id ON post_likes(post_id);
-CREATE INDEX idx_post_likes_user_id ON post_likes(user_id);
-
-CREATE INDEX idx_followers_follower_id ON followers(follower_id);
-CREATE INDEX idx_followers_followed_id ON followers(followed_id);
\ No newline at end of file
@@ -25,7 +25,7 @@ const CommentModeration: React.FC = () => {
     setLoading(true);
     try {
       const response = await api.get('/admin/comments');
-      setComments(response.data || []);
+      setComments(response.data.items || []);
     } catch (err: any) {
       setError(err.response?.data?.error || 'Failed to fetch comments');
       console.error('Error fetching comments:', err);
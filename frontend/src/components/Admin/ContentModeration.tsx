@@ -22,7 +22,7 @@ const ContentModeration: React.FC = () => {
     try {
       const response = await api.get('/posts');
       // Initialize with empty array if response.data is null or undefined
-      setPosts(response.data || []);
+      setPosts(response.data.items || []);
     } catch (err: any) {
       setError(err.response?.data?.error || 'Failed to fetch posts');
       console.error('Error fetching posts:', err);
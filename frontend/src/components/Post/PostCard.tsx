@@ -16,7 +16,7 @@ const PostCard: React.FC<PostCardProps> = ({ post, onClick, onPostUpdated }) =>
   const [videoLoaded, setVideoLoaded] = useState(false);
   const [isPlaying, setIsPlaying] = useState(false);
   const [showPlayButton, setShowPlayButton] = useState(true);
-  const [thumbnailUrl, setThumbnailUrl] = useState<string | null>(null);
+  const [thumbnailUrl, setThumbnailUrl] = useState<string | null>(post.thumbnailUrl || null);
   const [currentPost, setCurrentPost] = useState<Post>(post);
   const videoRef = useRef<HTMLVideoElement>(null);
   
@@ -214,6 +214,20 @@ const PostCard: React.FC<PostCardProps> = ({ post, onClick, onPostUpdated }) =>
             </svg>
           </div>
         )}
+
+        {/* Status overlay for the owner's posts that aren't published */}
+        {currentPost.status && currentPost.status !== 'ready' && (
+          <div className="absolute inset-0 flex flex-col items-center justify-center bg-black bg-opacity-60 text-white text-center p-4 z-30">
+            <p className="font-semibold">
+              {currentPost.status === 'processing' && 'Processing…'}
+              {currentPost.status === 'failed' && 'Upload failed'}
+              {currentPost.status === 'removed' && 'Removed'}
+            </p>
+            {currentPost.statusReason && (
+              <p className="text-xs mt-1">{currentPost.statusReason}</p>
+            )}
+          </div>
+        )}
       </div>
       <div className="p-3">
         <p className={`text-sm truncate ${
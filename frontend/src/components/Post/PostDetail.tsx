@@ -16,6 +16,10 @@ interface PostDetailProps {
   isAdmin?: boolean; // New prop
 }
 
+// Browsers with native HLS support (Safari, iOS) stream the adaptive playlist;
+// everything else plays the MP4 fallback
+const canPlayHls = document.createElement('video').canPlayType('application/vnd.apple.mpegurl') !== '';
+
 const PostDetail: React.FC<PostDetailProps> = ({ 
   post, 
   onClose, 
@@ -27,7 +31,7 @@ const PostDetail: React.FC<PostDetailProps> = ({
   const [imageError, setImageError] = useState(false);
   const [videoLoaded, setVideoLoaded] = useState(false);
   const [isLoadingVideo, setIsLoadingVideo] = useState(false);
-  const [thumbnailUrl, setThumbnailUrl] = useState<string | null>(null);
+  const [thumbnailUrl, setThumbnailUrl] = useState<string | null>(post.thumbnailUrl || null);
   const [isDeleting, setIsDeleting] = useState(false);
   const [isEditing, setIsEditing] = useState(false);
   const [editCaption, setEditCaption] = useState('');
@@ -269,7 +273,7 @@ const PostDetail: React.FC<PostDetailProps> = ({
                 
                 <video 
                   ref={videoRef}
-                  src={currentPost.mediaUrl} 
+                  src={canPlayHls && currentPost.playlistUrl ? currentPost.playlistUrl : currentPost.mediaUrl} 
                   className="w-full h-full object-contain z-10"
                   controls
                   controlsList="nodownload"
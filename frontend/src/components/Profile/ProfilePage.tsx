@@ -31,7 +31,7 @@ const ProfilePage: React.FC = () => {
 
       try {
         const response = await api.get(`/users/${user.id}/posts`);
-        setPosts(response.data || []);
+        setPosts(response.data.items || []);
       } catch (error) {
         console.error('Failed to fetch user posts:', error);
       } finally {
@@ -50,13 +50,10 @@ const ProfilePage: React.FC = () => {
       }
 
       try {
-        // Get follower count
-        const followersResponse = await api.get(`/follow/${user.id}/followers`);
-        setFollowerCount(followersResponse.data.length);
-        
-        // Get following count
-        const followingResponse = await api.get(`/follow/${user.id}/following`);
-        setFollowingCount(followingResponse.data.length);
+        // Follower lists are paginated, so read the totals from the profile
+        const profileResponse = await api.get(`/users/${user.id}/profile`);
+        setFollowerCount(profileResponse.data.followerCount);
+        setFollowingCount(profileResponse.data.followingCount);
       } catch (error) {
         console.error('Failed to fetch follow counts:', error);
       }
@@ -74,10 +71,10 @@ const ProfilePage: React.FC = () => {
       try {
         if (activeTab === 'followers') {
           const response = await api.get(`/follow/${user.id}/followers`);
-          setFollowers(response.data || []);
+          setFollowers(response.data.items || []);
         } else if (activeTab === 'following') {
           const response = await api.get(`/follow/${user.id}/following`);
-          setFollowing(response.data || []);
+          setFollowing(response.data.items || []);
         }
       } catch (err) {
         console.error(`Failed to fetch ${activeTab}:`, err);
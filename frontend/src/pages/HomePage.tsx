@@ -25,12 +25,13 @@ const HomePage: React.FC = () => {
     const fetchPosts = async () => {
       try {
         const response = await api.get('/posts');
-        setPosts(response.data || []);  // Provide empty array fallback
+        const fetchedPosts: Post[] = response.data.items || [];
+        setPosts(fetchedPosts);
         
         // Check if we need to open a specific post
         const postId = searchParams.get('postId');
         if (postId) {
-          const post = response.data.find((p: Post) => p.id === postId);
+          const post = fetchedPosts.find((p: Post) => p.id === postId);
           if (post) {
             setSelectedPost(post);
           }
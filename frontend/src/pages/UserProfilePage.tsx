@@ -64,7 +64,7 @@ const UserProfilePage: React.FC = () => {
         
         // Fetch user's posts
         const response = await api.get(`/users/${id}/posts`);
-        setPosts(response.data || []);
+        setPosts(response.data.items || []);
       } catch (err) {
         console.error('Failed to fetch user profile:', err);
         setError('Failed to load user profile');
@@ -1,9 +1,10 @@
 import api from './api';
 import { Post } from '../types/Post';
+import { Page } from '../types/Page';
 
-// Get all posts
-export const getPosts = async (): Promise<Post[]> => {
-  const response = await api.get<Post[]>('/posts');
+// Get a page of posts; pass the previous page's nextCursor to continue
+export const getPosts = async (cursor?: string): Promise<Page<Post>> => {
+  const response = await api.get<Page<Post>>('/posts', { params: { cursor } });
   return response.data;
 };
 
@@ -1,14 +1,15 @@
 import api from './api';
 import { User, UserWithFollowCount } from '../types/User';
+import { Page } from '../types/Page';
 
 // Search for users
 export const searchUsers = async (query: string): Promise<UserWithFollowCount[]> => {
   if (!query.trim()) return [];
   
   try {
-    const response = await api.get<UserWithFollowCount[]>(`/users/search?q=${encodeURIComponent(query)}`);
+    const response = await api.get<Page<UserWithFollowCount>>(`/users/search?q=${encodeURIComponent(query)}`);
     // Ensure we return an empty array if the response is null or undefined
-    return response.data || [];
+    return response.data?.items || [];
   } catch (error) {
     console.error('Search users API error:', error);
     // Return empty array on error
@@ -43,8 +44,8 @@ export const getFollowStatus = async (userId: string): Promise<{ isFollowing: bo
 // Get followers
 export const getFollowers = async (userId: string): Promise<UserWithFollowCount[]> => {
   try {
-    const response = await api.get<UserWithFollowCount[]>(`/follow/${userId}/followers`);
-    return response.data || [];
+    const response = await api.get<Page<UserWithFollowCount>>(`/follow/${userId}/followers`);
+    return response.data?.items || [];
   } catch (error) {
     console.error('Get followers API error:', error);
     return [];
@@ -54,8 +55,8 @@ export const getFollowers = async (userId: string): Promise<UserWithFollowCount[
 // Get following
 export const getFollowing = async (userId: string): Promise<UserWithFollowCount[]> => {
   try {
-    const response = await api.get<UserWithFollowCount[]>(`/follow/${userId}/following`);
-    return response.data || [];
+    const response = await api.get<Page<UserWithFollowCount>>(`/follow/${userId}/following`);
+    return response.data?.items || [];
   } catch (error) {
     console.error('Get following API error:', error);
     return [];
@@ -66,7 +67,7 @@ export const getFollowing = async (userId: string): Promise<UserWithFollowCount[
 export const getFollowingFeed = async (): Promise<any[]> => {
   try {
     const response = await api.get('/follow/feed');
-    return response.data || [];
+    return response.data?.items || [];
   } catch (error) {
     console.error('Get following feed API error:', error);
     return [];
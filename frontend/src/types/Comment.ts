@@ -1,8 +1,17 @@
+import { Entity } from './Entity';
+
 export interface Comment {
     id: string;
     postId: string;
-    userId: string;
+    parentCommentId?: string; // set on replies
+    depth: number; // 0 for top-level comments, at most 2
+    userId?: string; // absent on deleted comments
     username: string;
     content: string;
+    entities?: Entity[]; // mentions and hashtags in the content
+    replyCount: number; // direct replies, fetched from /posts/comments/:id/replies
+    likes: number;
+    liked?: boolean; // whether the current user liked the comment
+    deleted?: boolean; // removed by its author but kept for its replies
     createdAt: string;
-  }
\ No newline at end of file
+  }
@@ -0,0 +1,9 @@
+// An @mention or #hashtag in a caption or comment. start and end index the
+// text as a JavaScript string (UTF-16), include the @ or #, and end is exclusive.
+export interface Entity {
+  type: 'mention' | 'hashtag';
+  start: number;
+  end: number;
+  text: string; // username, or lowercase tag, without the @ or #
+  userId?: string; // the mentioned user
+}
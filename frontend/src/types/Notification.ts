@@ -0,0 +1,20 @@
+export interface NotificationActor {
+  id: string;
+  username: string;
+  profilePicture?: string;
+}
+
+// Follows, likes, comments and replies by several users are grouped into one
+// notification until it is read
+export interface Notification {
+  id: string;
+  type: 'follow' | 'like' | 'comment' | 'reply' | 'mention';
+  postId?: string;
+  commentId?: string; // the latest comment, or for replies the comment replied to
+  actors: NotificationActor[]; // the most recent few, newest first
+  actorCount: number;
+  message: string; // e.g. "alice and 4 others liked your post"
+  read: boolean;
+  createdAt: string;
+  updatedAt: string; // when the latest actor joined
+}
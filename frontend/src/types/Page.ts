@@ -0,0 +1,5 @@
+// Envelope returned by paginated list endpoints
+export interface Page<T> {
+  items: T[];
+  nextCursor?: string;
+}
@@ -1,15 +1,49 @@
 import { Comment } from './Comment';
+import { Entity } from './Entity';
+
+// One size and format of an image, for building a srcset
+export interface Rendition {
+  width: number;
+  height: number;
+  type: string; // e.g. image/avif, image/webp, image/jpeg
+  url: string;
+}
+
+export interface PostMedia {
+  position: number;
+  mediaUrl: string;
+  mediaType: 'image' | 'video';
+  thumbnailUrl?: string;
+  playlistUrl?: string;
+  width?: number; // of the image or video thumbnail
+  height?: number;
+  blurhash?: string; // painted until the media loads
+  dominantColor?: string; // e.g. #4a6b8c
+  capturedAt?: string; // retained image metadata, when the server keeps it
+  renditions?: Rendition[];
+}
 
 export interface Post {
   id: string;
   userId: string;
   username: string;
   caption: string;
+  entities?: Entity[]; // mentions and hashtags in the caption
   mediaUrl: string;
   mediaType: 'image' | 'video';
   createdAt: string;
   likes: number;
   liked?: boolean; // new field to track if the current user liked the post
-  comments: Comment[];
+  comments: Comment[]; // newest comments only when loaded from a feed
+  commentCount?: number;
   thumbnailUrl?: string;
+  playlistUrl?: string; // HLS master playlist; mediaUrl is the MP4 fallback
+  width?: number;
+  height?: number;
+  blurhash?: string;
+  dominantColor?: string;
+  status?: 'processing' | 'ready' | 'failed' | 'removed';
+  statusReason?: string; // why the post failed or was removed, shown to its owner
+  renditions?: Rendition[]; // the first item's renditions
+  media?: PostMedia[]; // every item of a carousel post, in order; the fields above describe the first
 }
\ No newline at end of file